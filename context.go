@@ -0,0 +1,78 @@
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package hook
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultDeliveryTimeout bounds the asynchronous deliveries of a Send
+const DefaultDeliveryTimeout = time.Minute
+
+const (
+	// abortTimeout is how long Close waits for the cancelled deliveries to
+	// return before leaving the senders open
+	abortTimeout = 5 * time.Second
+	// closeTimeout bounds the closing of a sender without deadline
+	closeTimeout = 5 * time.Second
+)
+
+// WithDeliveryTimeout sets the deadline of the asynchronous deliveries of a
+// Send, including the retries. Zero means no deadline
+func WithDeliveryTimeout(d time.Duration) Option {
+	return func(h *Hook) {
+		h.deliveryTimeout = d
+	}
+}
+
+// detachedContext keeps the values of a context, like the logger or the trace
+// ids, but takes its cancellation and deadline from another one
+type detachedContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.values.Value(key)
+}
+
+// detach returns a context with the values of ctx that is not cancelled with
+// it. It is cancelled when the Hook gives up on Close, or after the delivery
+// timeout
+func (h *Hook) detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	c := context.Context(detachedContext{Context: h.lifetime, values: ctx})
+	if h.deliveryTimeout > 0 {
+		return context.WithTimeout(c, h.deliveryTimeout)
+	}
+	return context.WithCancel(c)
+}
+
+// bind returns ctx also cancelled when the Hook gives up on Close, so the
+// synchronous deliveries stop with the asynchronous ones
+func (h *Hook) bind(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-h.lifetime.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
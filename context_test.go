@@ -0,0 +1,112 @@
+//go:build !integration
+
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package hook_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/w6d-io/hook"
+	"github.com/w6d-io/hook/event"
+)
+
+type contextKey string
+
+var _ = Describe("Context", func() {
+	It("gives the same event id to every subscriber", func() {
+		contexts := make(chan context.Context, 4)
+		h := hook.New(hook.WithProvider("http", func() hook.Interface { return &TestContext{Contexts: contexts} }))
+		Expect(h.Subscribe(context.Background(), "http://localhost/a", "*")).ToNot(BeEmpty())
+		Expect(h.Subscribe(context.Background(), "http://localhost/b", "*")).ToNot(BeEmpty())
+		Expect(h.Deliver(context.Background(), "message", "test")).ToNot(BeNil())
+		first, second := event.ID(<-contexts), event.ID(<-contexts)
+		Expect(first).ToNot(BeEmpty())
+		Expect(second).To(Equal(first))
+
+		By("keeping the id of the caller")
+		Expect(h.Deliver(event.WithID(context.Background(), "id"), "message", "test")).ToNot(BeNil())
+		Expect(event.ID(<-contexts)).To(Equal("id"))
+		Expect(event.ID(<-contexts)).To(Equal("id"))
+	})
+	It("stops the retries when the context is cancelled", func() {
+		h := hook.New(hook.WithProvider("http", NewTestSendFail))
+		Expect(h.Subscribe(context.Background(), "http://localhost?retries=10&backoff=fixed&initialDelay=1s", "*")).ToNot(BeEmpty())
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		report, err := h.Deliver(ctx, "message", "test")
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		Expect(report.Deliveries[0].Attempts).To(Equal(uint(1)))
+	})
+	It("detaches the asynchronous send from the caller cancellation", func() {
+		contexts := make(chan context.Context, 1)
+		release := make(chan struct{})
+		defer close(release)
+		h := hook.New(hook.WithProvider("http", func() hook.Interface {
+			return &TestContext{Contexts: contexts, Release: release}
+		}))
+		Expect(h.Subscribe(context.Background(), "http://localhost", "*")).ToNot(BeEmpty())
+		ctx, cancel := context.WithCancel(context.WithValue(context.Background(), contextKey("trace"), "id"))
+		Expect(h.Send(ctx, "message", "test")).To(Succeed())
+		cancel()
+		var sendCtx context.Context
+		Eventually(contexts).Should(Receive(&sendCtx))
+		Expect(sendCtx.Err()).To(Succeed())
+		Expect(sendCtx.Value(contextKey("trace"))).To(Equal("id"))
+		_, ok := sendCtx.Deadline()
+		Expect(ok).To(BeTrue())
+	})
+	It("applies the delivery timeout", func() {
+		reports := make(chan *hook.DeliveryReport, 1)
+		h := hook.New(
+			hook.WithProvider("http", func() hook.Interface {
+				return &TestContext{Contexts: make(chan context.Context, 10), Wait: true}
+			}),
+			hook.WithDeliveryTimeout(20*time.Millisecond),
+			hook.WithReportHandler(func(_ context.Context, r *hook.DeliveryReport) { reports <- r }),
+		)
+		Expect(h.Subscribe(context.Background(), "http://localhost", "*")).ToNot(BeEmpty())
+		Expect(h.Send(context.Background(), "message", "test")).To(Succeed())
+		var report *hook.DeliveryReport
+		Eventually(reports).Should(Receive(&report))
+		Expect(report.Err()).To(MatchError(context.DeadlineExceeded))
+	})
+	It("cancels the deliveries abandoned on Close", func() {
+		contexts := make(chan context.Context, 10)
+		h := hook.New(
+			hook.WithProvider("http", func() hook.Interface {
+				return &TestContext{Contexts: contexts, Wait: true}
+			}),
+			hook.WithDeliveryTimeout(0),
+		)
+		Expect(h.Subscribe(context.Background(), "http://localhost", "*")).ToNot(BeEmpty())
+		Expect(h.Send(context.Background(), "message", "test")).To(Succeed())
+		var sendCtx context.Context
+		Eventually(contexts).Should(Receive(&sendCtx))
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		Expect(h.Close(ctx)).To(MatchError(hook.ErrDropped))
+		Eventually(sendCtx.Done()).Should(BeClosed())
+	})
+})
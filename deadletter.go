@@ -0,0 +1,190 @@
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package hook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/w6d-io/hook/event"
+
+	"github.com/w6d-io/x/logx"
+)
+
+// maxDeadLetters is the number of dead letters kept in memory for Redrive, the
+// oldest ones are forgotten first. They stay in the dead-letter target
+const maxDeadLetters = 1000
+
+// deadLetterTimeout bounds the sending of a dead letter, the delivery context
+// being often expired by then
+const deadLetterTimeout = 10 * time.Second
+
+// DeadLetter is sent to the dead-letter target of a subscription when a
+// delivery exhausts its retries
+type DeadLetter struct {
+	ID             string          `json:"id"`
+	EventID        string          `json:"eventId,omitempty"`
+	SubscriptionID string          `json:"subscriptionId"`
+	URL            string          `json:"url"`
+	Scope          string          `json:"scope"`
+	Payload        json.RawMessage `json:"payload"`
+	Error          string          `json:"error"`
+	Attempts       uint            `json:"attempts"`
+	FirstAttemptAt time.Time       `json:"firstAttemptAt"`
+	FailedAt       time.Time       `json:"failedAt"`
+}
+
+// DeadLetters returns the dead letters recorded by the Hook, oldest first.
+// They are kept in memory for the lifetime of the Hook, up to the last 1000.
+// The dead-letter targets are never read back: the older letters and the ones
+// of a previous process are only there, to be replayed by the application
+func (h *Hook) DeadLetters() []DeadLetter {
+	h.dlMu.Lock()
+	defer h.dlMu.Unlock()
+	letters := make([]DeadLetter, len(h.deadLetters))
+	copy(letters, h.deadLetters)
+	return letters
+}
+
+// ForgottenDeadLetters returns the number of dead letters no longer kept for
+// Redrive because of the 1000 limit
+func (h *Hook) ForgottenDeadLetters() uint64 {
+	h.dlMu.Lock()
+	defer h.dlMu.Unlock()
+	return h.dlForgotten
+}
+
+// Redrive sends the payload of the dead letter again to its subscription.
+// The dead letter is forgotten once delivered. Only the letters listed by
+// DeadLetters can be redriven
+func (h *Hook) Redrive(ctx context.Context, id string) (Delivery, error) {
+	log := logx.WithName(ctx, "Hook.Redrive").WithValues("id", id)
+
+	h.dlMu.Lock()
+	var (
+		letter DeadLetter
+		found  bool
+	)
+	for _, l := range h.deadLetters {
+		if l.ID == id {
+			letter, found = l, true
+			break
+		}
+	}
+	h.dlMu.Unlock()
+	if !found {
+		return Delivery{}, fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+	}
+
+	if err := h.acquire(); err != nil {
+		return Delivery{}, err
+	}
+	defer h.release()
+	ctx, cancel := h.bind(ctx)
+	defer cancel()
+
+	h.mu.RLock()
+	var (
+		sub subscriber
+		ok  bool
+	)
+	for _, s := range h.subscribers {
+		if s.ID == letter.SubscriptionID {
+			sub, ok = s, true
+			sub.use()
+			break
+		}
+	}
+	h.mu.RUnlock()
+	if !ok {
+		return Delivery{}, fmt.Errorf("%w: %s", ErrSubscriptionNotFound, letter.SubscriptionID)
+	}
+	defer sub.release(ctx)
+	// the scope matched on the first delivery
+	sub.scope = matchAll
+	sub.DeadLetter = nil
+	if letter.EventID != "" {
+		ctx = event.WithID(ctx, letter.EventID)
+	}
+	d := h.deliverTo(ctx, letter.Payload, letter.Scope, sub)
+	if d.Status != StatusDelivered {
+		log.Error(d.Err, "redrive failed")
+		return d, d.Err
+	}
+	h.dlMu.Lock()
+	for i := range h.deadLetters {
+		if h.deadLetters[i].ID == id {
+			h.deadLetters = append(h.deadLetters[:i], h.deadLetters[i+1:]...)
+			break
+		}
+	}
+	h.dlMu.Unlock()
+	return d, nil
+}
+
+// deadLetter sends the failed delivery to the dead-letter target of the
+// subscription and records it for Redrive
+func (h *Hook) deadLetter(ctx context.Context, payload interface{}, scope string, sub subscriber, d Delivery, start time.Time) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	letter := DeadLetter{
+		ID:             uuid.New().String(),
+		EventID:        event.ID(ctx),
+		SubscriptionID: sub.ID,
+		URL:            sub.URL.Redacted(),
+		Scope:          scope,
+		Payload:        data,
+		Error:          d.Err.Error(),
+		Attempts:       d.Attempts,
+		FirstAttemptAt: start.UTC(),
+		FailedAt:       time.Now().UTC(),
+	}
+	resolvedUrl, err := ResolveUrl(ctx, letter, sub.DeadLetter.URL)
+	if err != nil {
+		return "", err
+	}
+	// the delivery may have failed on its deadline, the letter gets its own
+	ctx, cancel := context.WithTimeout(detachedContext{Context: h.lifetime, values: ctx}, deadLetterTimeout)
+	defer cancel()
+	if err := sub.DeadLetter.Sender.Send(ctx, letter, resolvedUrl); err != nil {
+		return "", err
+	}
+	h.keepDeadLetter(ctx, letter)
+	return letter.ID, nil
+}
+
+// keepDeadLetter records the dead letter for Redrive, forgetting the oldest
+// one past maxDeadLetters
+func (h *Hook) keepDeadLetter(ctx context.Context, letter DeadLetter) {
+	h.dlMu.Lock()
+	defer h.dlMu.Unlock()
+	if len(h.deadLetters) >= maxDeadLetters {
+		forgotten := h.deadLetters[0]
+		h.deadLetters = h.deadLetters[1:]
+		h.dlForgotten++
+		logx.WithName(ctx, "Hook.deadLetter").Info("dead letter no longer redrivable",
+			"id", forgotten.ID, "subscriptionId", forgotten.SubscriptionID, "forgotten", h.dlForgotten)
+	}
+	h.deadLetters = append(h.deadLetters, letter)
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+// Package event carries the metadata of the payload being delivered from the
+// Hook to the providers
+package event
+
+import "context"
+
+type (
+	idKey    struct{}
+	scopeKey struct{}
+	traceKey struct{}
+)
+
+// TraceContext is the W3C trace context of the payload, forwarded to the
+// targets able to carry it
+type TraceContext struct {
+	TraceParent string
+	TraceState  string
+}
+
+// WithID returns a context holding the id of the payload. The id is the same
+// for every subscriber and every attempt, so the receivers can deduplicate
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, idKey{}, id)
+}
+
+// ID returns the id of the payload, empty when none
+func ID(ctx context.Context) string {
+	id, _ := ctx.Value(idKey{}).(string)
+	return id
+}
+
+// WithScope returns a context holding the scope the payload was sent with
+func WithScope(ctx context.Context, scope string) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope)
+}
+
+// Scope returns the scope of the payload, empty when none
+func Scope(ctx context.Context) string {
+	scope, _ := ctx.Value(scopeKey{}).(string)
+	return scope
+}
+
+// WithTraceContext returns a context holding the trace context to forward
+func WithTraceContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceKey{}, tc)
+}
+
+// Trace returns the trace context to forward, zero when none
+func Trace(ctx context.Context) TraceContext {
+	tc, _ := ctx.Value(traceKey{}).(TraceContext)
+	return tc
+}
@@ -0,0 +1,70 @@
+//go:build !integration
+
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package event_test
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/w6d-io/hook/event"
+)
+
+var _ = Describe("Event", func() {
+	It("carries the id", func() {
+		ctx := event.WithID(context.Background(), "id")
+		Expect(event.ID(ctx)).To(Equal("id"))
+	})
+	It("has no metadata by default", func() {
+		Expect(event.ID(context.Background())).To(BeEmpty())
+		Expect(event.Scope(context.Background())).To(BeEmpty())
+		Expect(event.Trace(context.Background())).To(BeZero())
+	})
+	It("carries the scope and the trace context", func() {
+		tc := event.TraceContext{TraceParent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", TraceState: "w6d=1"}
+		ctx := event.WithTraceContext(event.WithScope(context.Background(), "test"), tc)
+		Expect(event.Scope(ctx)).To(Equal("test"))
+		Expect(event.Trace(ctx)).To(Equal(tc))
+	})
+	Context("Pending", func() {
+		It("is not deferred without a waiting caller", func() {
+			Expect(event.Defer(context.Background())).To(BeNil())
+		})
+		It("returns the outcome given by the provider", func() {
+			ctx, pending := event.WithPending(context.Background())
+			Expect(pending.Deferred()).To(BeFalse())
+			ack := event.Defer(ctx)
+			Expect(pending.Deferred()).To(BeTrue())
+			go ack(errors.New("broker down"))
+			Expect(pending.Wait(context.Background())).To(MatchError("broker down"))
+			ack(nil)
+			Expect(pending.Wait(context.Background())).To(MatchError("broker down"))
+		})
+		It("stops waiting when the context is done", func() {
+			ctx, pending := event.WithPending(context.Background())
+			event.Defer(ctx)
+			done, cancel := context.WithCancel(context.Background())
+			cancel()
+			Expect(pending.Wait(done)).To(MatchError(context.Canceled))
+		})
+	})
+})
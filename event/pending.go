@@ -0,0 +1,76 @@
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package event
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+type pendingKey struct{}
+
+// Pending is the outcome of a delivery the provider confirms after Send
+// returned, like a kafka record produced asynchronously
+type Pending struct {
+	deferred atomic.Bool
+	once     sync.Once
+	done     chan struct{}
+	err      error
+}
+
+// WithPending returns a context in which the provider can defer the outcome
+// of the delivery, and the Pending to wait for it
+func WithPending(ctx context.Context) (context.Context, *Pending) {
+	p := &Pending{done: make(chan struct{})}
+	return context.WithValue(ctx, pendingKey{}, p), p
+}
+
+// Defer marks the delivery as confirmed later and returns the function to
+// call once with its outcome. It is nil when the caller does not wait
+func Defer(ctx context.Context) func(error) {
+	p, _ := ctx.Value(pendingKey{}).(*Pending)
+	if p == nil {
+		return nil
+	}
+	p.deferred.Store(true)
+	return p.resolve
+}
+
+// Deferred tells whether the provider deferred the outcome
+func (p *Pending) Deferred() bool {
+	return p.deferred.Load()
+}
+
+// Wait returns the outcome given by the provider, or the context error when
+// done first
+func (p *Pending) Wait(ctx context.Context) error {
+	select {
+	case <-p.done:
+		return p.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Pending) resolve(err error) {
+	p.once.Do(func() {
+		p.err = err
+		close(p.done)
+	})
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+
+	"github.com/w6d-io/x/logx"
+)
+
+func (f *File) Init(_ context.Context, _ *url.URL) error {
+	return nil
+}
+
+// Send appends the payload to the file of the URL path. The file is opened on
+// each call so it can be rotated
+func (f *File) Send(ctx context.Context, payload interface{}, URL *url.URL) error {
+	log := logx.WithName(ctx, "File.Send").WithValues("path", URL.Path)
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Error(err, "marshal failed")
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fd, err := os.OpenFile(URL.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		log.Error(err, "open failed")
+		return err
+	}
+	if _, err := fd.Write(append(data, '\n')); err != nil {
+		_ = fd.Close()
+		log.Error(err, "write failed")
+		return err
+	}
+	return fd.Close()
+}
+
+func (f *File) Validate(URL *url.URL) error {
+	if URL == nil {
+		return nil
+	}
+	if URL.Path == "" {
+		return errors.New("missing path")
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+//go:build !integration
+
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package file_test
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/w6d-io/hook/file"
+)
+
+var _ = Describe("File", func() {
+	Context("Validate", func() {
+		It("url is nil", func() {
+			Expect((&file.File{}).Validate(nil)).To(Succeed())
+		})
+		It("misses the path", func() {
+			URL, _ := url.Parse("file://")
+			Expect((&file.File{}).Validate(URL)).To(MatchError("missing path"))
+		})
+	})
+	Context("Send", func() {
+		It("appends json lines", func() {
+			path := filepath.Join(GinkgoT().TempDir(), "events.jsonl")
+			URL, _ := url.Parse("file://" + path)
+			f := &file.File{}
+			Expect(f.Init(context.Background(), URL)).To(Succeed())
+			Expect(f.Send(context.Background(), map[string]string{"id": "1"}, URL)).To(Succeed())
+			Expect(f.Send(context.Background(), map[string]string{"id": "2"}, URL)).To(Succeed())
+			data, err := os.ReadFile(path)
+			Expect(err).To(Succeed())
+			Expect(string(data)).To(Equal(`{"id":"1"}` + "\n" + `{"id":"2"}` + "\n"))
+		})
+		It("wrong payload", func() {
+			URL, _ := url.Parse("file:///tmp/unused.jsonl")
+			Expect((&file.File{}).Send(context.Background(), make(chan int), URL)).ToNot(Succeed())
+		})
+		It("cannot open the file", func() {
+			URL, _ := url.Parse("file:///nonexistent/dir/events.jsonl")
+			Expect((&file.File{}).Send(context.Background(), "message", URL)).ToNot(Succeed())
+		})
+	})
+})
@@ -4,19 +4,21 @@ go 1.20
 
 require (
 	github.com/avast/retry-go v3.0.0+incompatible
+	github.com/confluentinc/confluent-kafka-go v1.9.1
 	github.com/google/uuid v1.5.0
+	github.com/klauspost/compress v1.17.4
 	github.com/onsi/ginkgo/v2 v2.13.2
 	github.com/onsi/gomega v1.30.0
 	github.com/w6d-io/x/kafkax v0.0.0-20220921191837-8e3344034e0a
 	github.com/w6d-io/x/logx v0.0.0-20220921191837-8e3344034e0a
 	go.uber.org/zap v1.26.0
+	golang.org/x/oauth2 v0.5.0
 	sigs.k8s.io/controller-runtime v0.15.3
 )
 
 require (
 	github.com/beorn7/perks v1.0.1 // indirect
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
-	github.com/confluentinc/confluent-kafka-go v1.9.1 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/emicklei/go-restful/v3 v3.9.0 // indirect
 	github.com/evanphx/json-patch/v5 v5.6.0 // indirect
@@ -50,7 +52,6 @@ require (
 	github.com/spf13/pflag v1.0.5 // indirect
 	go.uber.org/multierr v1.10.0 // indirect
 	golang.org/x/net v0.17.0 // indirect
-	golang.org/x/oauth2 v0.5.0 // indirect
 	golang.org/x/sys v0.14.0 // indirect
 	golang.org/x/term v0.13.0 // indirect
 	golang.org/x/text v0.13.0 // indirect
@@ -21,79 +21,311 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"text/template"
+	"time"
 
+	"github.com/avast/retry-go"
+	"github.com/google/uuid"
+
+	"github.com/w6d-io/hook/event"
+	"github.com/w6d-io/hook/file"
 	"github.com/w6d-io/hook/http"
 	"github.com/w6d-io/hook/kafka"
 
 	"github.com/w6d-io/x/logx"
 )
 
-func init() {
-	AddProvider("kafka", &kafka.Kafka{})
-	AddProvider("http", &http.HTTP{})
-	AddProvider("https", &http.HTTP{})
+// New returns a Hook with its own providers and subscribers. The built-in
+// providers are registered before the options are applied
+func New(opts ...Option) *Hook {
+	h := &Hook{
+		suppliers:       make(providers),
+		done:            make(chan struct{}),
+		retryPolicy:     DefaultRetryPolicy,
+		deliveryTimeout: DefaultDeliveryTimeout,
+		replayLimit:     DefaultReplayLimit,
+	}
+	h.lifetime, h.cancel = context.WithCancel(context.Background())
+	h.AddProvider("kafka", func() Interface { return &kafka.Kafka{} })
+	h.AddProvider("http", func() Interface { return &http.HTTP{} })
+	h.AddProvider("https", func() Interface { return &http.HTTP{} })
+	h.AddProvider("file", func() Interface { return &file.File{} })
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.outbox != nil && h.replayInterval > 0 {
+		go h.replayLoop()
+	}
+	for i := 0; h.queue != nil && i < h.workers; i++ {
+		go h.work()
+	}
+	return h
+}
+
+// WithReportHandler sets the function called with the delivery report of
+// every asynchronous Send
+func WithReportHandler(f func(context.Context, *DeliveryReport)) Option {
+	return func(h *Hook) {
+		h.reportHandler = f
+	}
+}
+
+// WithProvider registers or replaces the provider factory for the scheme
+func WithProvider(name string, f Factory) Option {
+	return func(h *Hook) {
+		h.AddProvider(name, f)
+	}
 }
 
+// Send calls Send on the default Hook
 func Send(ctx context.Context, payload interface{}, scope string) error {
+	return defaultHook.Send(ctx, payload, scope)
+}
+
+// DoSend calls DoSend on the default Hook
+func DoSend(ctx context.Context, payload interface{}, scope string) error {
+	return defaultHook.DoSend(ctx, payload, scope)
+}
+
+// AddProvider calls AddProvider on the default Hook
+func AddProvider(name string, f Factory) {
+	defaultHook.AddProvider(name, f)
+}
+
+// Subscribe calls Subscribe on the default Hook
+func Subscribe(ctx context.Context, URLRaw, scope string) (string, error) {
+	return defaultHook.Subscribe(ctx, URLRaw, scope)
+}
+
+// Unsubscribe calls Unsubscribe on the default Hook
+func Unsubscribe(id string) error {
+	return defaultHook.Unsubscribe(id)
+}
+
+// CleanSubscriber calls CleanSubscriber on the default Hook
+func CleanSubscriber() {
+	defaultHook.CleanSubscriber()
+}
+
+// Deliver calls Deliver on the default Hook
+func Deliver(ctx context.Context, payload interface{}, scope string) (*DeliveryReport, error) {
+	return defaultHook.Deliver(ctx, payload, scope)
+}
+
+// Close calls Close on the default Hook
+func Close(ctx context.Context) error {
+	return defaultHook.Close(ctx)
+}
+
+// Send runs DoSend in background and returns immediately. The report of the
+// deliveries is given to the handler set by WithReportHandler. With an outbox
+// the payload is persisted before Send returns.
+// The deliveries keep the values of ctx but not its cancellation, they are
+// bounded by the delivery timeout instead
+func (h *Hook) Send(ctx context.Context, payload interface{}, scope string) error {
 	log := logx.WithName(ctx, "Hook.Send")
-	log.V(1).Info("to send", "payload", payload)
-	go func(ctx context.Context, payload interface{}) {
-		if err := DoSend(ctx, payload, scope); err != nil {
-			log.Error(err, "DoSend")
-			return
+	if err := h.acquire(); err != nil {
+		return err
+	}
+	var entry string
+	if h.outbox != nil {
+		var err error
+		if entry, err = h.outbox.add(scope, payload, h.expected(scope)); err != nil {
+			h.release()
+			log.Error(err, "write to outbox failed")
+			return err
 		}
-	}(ctx, payload)
-	return nil
+	}
+	log.V(1).Info("to send", "payload", payload)
+	j := job{ctx: ctx, payload: payload, scope: scope, entry: entry}
+	if h.queue == nil {
+		go h.run(j)
+		return nil
+	}
+	return h.enqueue(ctx, j)
+}
+
+// run delivers the job of an asynchronous Send
+func (h *Hook) run(j job) {
+	log := logx.WithName(j.ctx, "Hook.Send")
+	defer h.release()
+	ctx, cancel := h.detach(j.ctx)
+	defer cancel()
+	if j.entry != "" {
+		// the same id when the entry is replayed
+		ctx = event.WithID(ctx, j.entry)
+	}
+	report, settled := h.deliver(ctx, j.payload, j.scope, nil)
+	if h.outbox != nil {
+		h.settle(ctx, j.entry, report, settled)
+	}
+	if h.reportHandler != nil {
+		h.reportHandler(ctx, report)
+	}
+	if err := report.Err(); err != nil {
+		log.Error(err, "DoSend")
+		return
+	}
 }
 
 // DoSend loops into all the subscribers url. for each it get the function by the scheme and run the method/function associated
-func DoSend(ctx context.Context, payload interface{}, scope string) error {
-	log := logx.WithName(ctx, "Hook.DoSend")
-	errc := make(chan error, len(subscribers))
-	quit := make(chan struct{})
-	defer close(quit)
+func (h *Hook) DoSend(ctx context.Context, payload interface{}, scope string) error {
+	_, err := h.Deliver(ctx, payload, scope)
+	return err
+}
 
-	for _, sub := range subscribers {
-		go func(payload interface{}, subScope string, subURL *url.URL) {
-			logg := log.WithValues("url", subURL)
-			if !isInScope(ctx, subScope, scope) {
-				log.V(1).Info("skip", "sub", subURL.String())
-				errc <- nil
-			} else {
-				f := suppliers[subURL.Scheme]
-				resolvedUrl, err := ResolveUrl(ctx, payload, subURL)
-				if err != nil {
-					logg.Error(err, "error while resolving url")
-					errc <- err
-				} else {
-					select {
-					case errc <- f.Send(ctx, payload, resolvedUrl):
-						logg.Info("sent")
-					case <-quit:
-						logg.Info("quit")
-					}
-				}
+// Deliver sends the payload to all the subscribers in scope and waits for
+// them. The report holds the outcome of each subscription, the error joins
+// the failed ones
+func (h *Hook) Deliver(ctx context.Context, payload interface{}, scope string) (*DeliveryReport, error) {
+	if err := h.acquire(); err != nil {
+		return nil, err
+	}
+	defer h.release()
+	report, _ := h.deliver(ctx, payload, scope, nil)
+	return report, report.Err()
+}
+
+// expected returns the keys of the subscribers in scope
+func (h *Hook) expected(scope string) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var keys []string
+	for _, sub := range h.subscribers {
+		if sub.inScope(scope) {
+			keys = append(keys, sub.key)
+		}
+	}
+	return keys
+}
+
+// deliver sends the payload to the subscribers with a key accepted by
+// targets, all of them when nil. It returns the keys of the subscribers
+// delivered or dead lettered
+func (h *Hook) deliver(ctx context.Context, payload interface{}, scope string, targets func(key string) bool) (*DeliveryReport, []string) {
+	if event.ID(ctx) == "" {
+		ctx = event.WithID(ctx, uuid.New().String())
+	}
+	ctx, cancel := h.bind(ctx)
+	defer cancel()
+	h.mu.RLock()
+	subscribers := h.subscribers
+	if targets != nil {
+		subscribers = nil
+		for _, sub := range h.subscribers {
+			if targets(sub.key) {
+				subscribers = append(subscribers, sub)
 			}
-		}(payload, sub.Scope, sub.URL)
+		}
 	}
-	for range subscribers {
-		if err := <-errc; err != nil {
-			log.Error(err, "Sent failed")
-			return err
+	for _, sub := range subscribers {
+		sub.use()
+	}
+	h.mu.RUnlock()
+
+	report := &DeliveryReport{
+		Scope:      scope,
+		Deliveries: make([]Delivery, len(subscribers)),
+	}
+	var wg sync.WaitGroup
+	for i := range subscribers {
+		wg.Add(1)
+		go func(d *Delivery, sub subscriber) {
+			defer wg.Done()
+			defer sub.release(ctx)
+			*d = h.deliverTo(ctx, payload, scope, sub)
+		}(&report.Deliveries[i], subscribers[i])
+	}
+	wg.Wait()
+	var settled []string
+	for i, d := range report.Deliveries {
+		if d.Status == StatusDelivered || d.DeadLetterID != "" {
+			settled = append(settled, subscribers[i].key)
 		}
 	}
+	return report, settled
+}
 
-	return nil
+// deliverTo sends the payload to one subscriber, retrying on failure. The
+// failed delivery goes to the dead-letter target of the subscriber if any
+func (h *Hook) deliverTo(ctx context.Context, payload interface{}, scope string, sub subscriber) (d Delivery) {
+	log := logx.WithName(ctx, "Hook.DoSend").WithValues("url", sub.URL.Redacted())
+	ctx = event.WithScope(ctx, scope)
+	d = Delivery{
+		SubscriptionID: sub.ID,
+		URL:            sub.URL.Redacted(),
+		Status:         StatusSkipped,
+	}
+	if !sub.inScope(scope) {
+		log.V(1).Info("skip")
+		return d
+	}
+	start := time.Now()
+	if sub.DeadLetter != nil {
+		defer func() {
+			if d.Status != StatusFailed {
+				return
+			}
+			id, err := h.deadLetter(ctx, payload, scope, sub, d, start)
+			if err != nil {
+				log.Error(err, "dead letter failed")
+				return
+			}
+			log.Info("dead lettered", "id", id)
+			d.DeadLetterID = id
+		}()
+	}
+	resolvedUrl, err := ResolveUrl(ctx, payload, sub.URL)
+	if err != nil {
+		log.Error(err, "error while resolving url")
+		d.Status, d.Err = StatusFailed, err
+		d.Latency = time.Since(start)
+		return d
+	}
+	err = retry.Do(
+		func() error {
+			d.Attempts++
+			return sub.Retry.within(ctx, send(ctx, sub.Sender, payload, resolvedUrl))
+		},
+		sub.Retry.options(ctx)...,
+	)
+	d.Latency = time.Since(start)
+	if err != nil {
+		log.Error(err, "Sent failed", "attempts", d.Attempts)
+		d.Status, d.Err = StatusFailed, err
+		return d
+	}
+	log.Info("sent")
+	d.Status = StatusDelivered
+	return d
+}
+
+// send calls the sender and waits for the outcome it deferred, if any, so an
+// asynchronous failure is retried and reported like a synchronous one
+func send(ctx context.Context, sender Interface, payload interface{}, URL *url.URL) error {
+	ctx, pending := event.WithPending(ctx)
+	if err := sender.Send(ctx, payload, URL); err != nil {
+		return err
+	}
+	if !pending.Deferred() {
+		return nil
+	}
+	return pending.Wait(ctx)
 }
 
-// AddProvider adds the protocol Send function to the suppliers list
-func AddProvider(name string, i Interface) {
-	suppliers[name] = i
+// AddProvider adds the protocol factory to the suppliers list. The factory is
+// called on each subscription so every subscriber gets its own configured sender
+func (h *Hook) AddProvider(name string, f Factory) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.suppliers[name] = f
 }
 
 // DelProvider adds the protocol Send function to the suppliers list
@@ -101,50 +333,337 @@ func AddProvider(name string, i Interface) {
 //     delete(suppliers, name)
 // }
 
-// Subscribe recorder the suppliers and its scope in subscribers
-func Subscribe(ctx context.Context, URLRaw, scope string) error {
+// Subscribe recorder the suppliers and its scope in subscribers. It returns the
+// id of the subscription to use with Unsubscribe
+func (h *Hook) Subscribe(ctx context.Context, URLRaw, scope string) (string, error) {
 
 	log := logx.WithName(ctx, "Hook.Subscribe")
 
-	URL, err := url.Parse(URLRaw)
+	h.mu.RLock()
+	closed := h.closed
+	h.mu.RUnlock()
+	if closed {
+		return "", ErrClosed
+	}
+
+	URL, err := parseURL(URLRaw)
 	if err != nil {
 		log.Error(err, "URL parsing", "url", URLRaw)
-		return err
+		return "", err
 	}
-	s, ok := suppliers[URL.Scheme]
-	if !ok {
-		err := fmt.Errorf("provider %v not supported", URL.Scheme)
+	f, err := h.factory(URL.Scheme)
+	if err != nil {
 		log.Error(err, "check provider")
-		return err
+		return "", err
 	}
+	options := stripQuery(URL, hookParams...)
+	policy, err := ParseRetryPolicy(h.retryPolicy, options)
+	if err != nil {
+		log.Error(err, "retry policy parsing")
+		return "", err
+	}
+	s := f()
 
 	if err := s.Validate(URL); err != nil {
 		log.Error(err, "validation failed")
-		return err
+		return "", err
 	}
 
 	if err := s.Init(ctx, URL); err != nil {
 		log.Error(err, "initialization failed")
-		return err
+		return "", err
 	}
 
 	w := subscriber{
-		URL:   URL,
-		Scope: scope,
+		ID:     uuid.New().String(),
+		URL:    URL,
+		Scope:  scope,
+		Sender: s,
+		Retry:  policy,
+		scope:  compileScope(ctx, scope),
+		key:    subscriptionKey(URLRaw),
+		usage:  &usage{},
+	}
+
+	if raw := options.Get("deadLetter"); raw != "" {
+		dl, err := h.newTarget(ctx, raw)
+		if err != nil {
+			log.Error(err, "dead letter target failed")
+			if err := w.close(ctx); err != nil {
+				log.Error(err, "close sender failed")
+			}
+			return "", fmt.Errorf("dead letter: %w", err)
+		}
+		w.DeadLetter = dl
 	}
 
-	subscribers = append(subscribers, w)
+	h.mu.Lock()
+	if h.closed {
+		// closed while initializing
+		h.mu.Unlock()
+		if err := w.close(ctx); err != nil {
+			log.Error(err, "close sender failed")
+		}
+		return "", ErrClosed
+	}
+	// copy on write so in-flight DoSend keep ranging over their own snapshot
+	subscribers := make([]subscriber, len(h.subscribers), len(h.subscribers)+1)
+	copy(subscribers, h.subscribers)
+	h.subscribers = append(subscribers, w)
+	h.mu.Unlock()
+	return w.ID, nil
+}
+
+// newTarget parses the URL and returns a sender validated and initialized for it
+func (h *Hook) newTarget(ctx context.Context, URLRaw string) (*target, error) {
+	URL, err := parseURL(URLRaw)
+	if err != nil {
+		return nil, err
+	}
+	f, err := h.factory(URL.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	s := f()
+	if err := s.Validate(URL); err != nil {
+		return nil, err
+	}
+	if err := s.Init(ctx, URL); err != nil {
+		return nil, err
+	}
+	return &target{URL: URL, Sender: s}, nil
+}
+
+func (h *Hook) factory(scheme string) (Factory, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	f, ok := h.suppliers[scheme]
+	if !ok {
+		return nil, fmt.Errorf("provider %v not supported", scheme)
+	}
+	return f, nil
+}
+
+// stripQuery removes the keys from the URL query and returns their values. The
+// other parameters are kept as is, so templates in them are not escaped
+func stripQuery(URL *url.URL, keys ...string) url.Values {
+	removed := url.Values{}
+	if URL.RawQuery == "" {
+		return removed
+	}
+	var kept []string
+	for _, pair := range strings.Split(URL.RawQuery, "&") {
+		k, v, _ := strings.Cut(pair, "=")
+		key, err := url.QueryUnescape(k)
+		if err != nil || !contains(keys, key) {
+			kept = append(kept, pair)
+			continue
+		}
+		value, err := url.QueryUnescape(v)
+		if err != nil {
+			value = v
+		}
+		removed.Add(key, value)
+	}
+	URL.RawQuery = strings.Join(kept, "&")
+	return removed
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Unsubscribe removes the subscription recorded under id. Its senders are
+// closed once the deliveries in flight with them are done
+func (h *Hook) Unsubscribe(id string) error {
+	log := logx.WithName(context.TODO(), "Hook.Unsubscribe")
+	h.mu.Lock()
+	for i := range h.subscribers {
+		if h.subscribers[i].ID != id {
+			continue
+		}
+		removed := h.subscribers[i]
+		subscribers := make([]subscriber, 0, len(h.subscribers)-1)
+		subscribers = append(subscribers, h.subscribers[:i]...)
+		h.subscribers = append(subscribers, h.subscribers[i+1:]...)
+		h.mu.Unlock()
+		if err := removed.remove(context.Background()); err != nil {
+			log.Error(err, "close sender failed", "id", id)
+		}
+		return nil
+	}
+	h.mu.Unlock()
+	return fmt.Errorf("%w: %s", ErrSubscriptionNotFound, id)
+}
+
+// CleanSubscriber removes all the subscriptions, closing their senders once
+// unused
+func (h *Hook) CleanSubscriber() {
+	log := logx.WithName(context.TODO(), "Hook.CleanSubscriber")
+	h.mu.Lock()
+	removed := h.subscribers
+	h.subscribers = []subscriber{}
+	h.mu.Unlock()
+	for _, sub := range removed {
+		if err := sub.remove(context.Background()); err != nil {
+			log.Error(err, "close sender failed", "id", sub.ID)
+		}
+	}
+}
+
+// Close stops accepting new sends and waits for the pending deliveries until
+// ctx is done. Past it, the deliveries are cancelled and given abortTimeout to
+// return. Then it closes the outbox and the senders implementing Closer. When
+// deliveries are still running, they are left open rather than closed under
+// them. The returned error reports the deliveries dropped and the senders that
+// failed to close
+func (h *Hook) Close(ctx context.Context) error {
+	log := logx.WithName(ctx, "Hook.Close")
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return ErrClosed
+	}
+	h.closed = true
+	subscribers := h.subscribers
+	h.mu.Unlock()
+	close(h.done)
+	defer h.cancel()
+
+	var errs []error
+	drained := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		log.V(1).Info("all deliveries done")
+	case <-ctx.Done():
+		n := atomic.LoadInt64(&h.pending)
+		log.Error(ctx.Err(), "deliveries still pending", "count", n)
+		errs = append(errs, fmt.Errorf("%w: %d sends still pending", ErrDropped, n))
+		// abort the deliveries left behind
+		h.cancel()
+		select {
+		case <-drained:
+		case <-time.After(abortTimeout):
+			err := fmt.Errorf("%w: deliveries still running, outbox and senders left open", ErrDropped)
+			log.Error(err, "abort failed")
+			return errors.Join(append(errs, err)...)
+		}
+	}
+	if h.outbox != nil {
+		if err := h.outbox.Close(); err != nil {
+			log.Error(err, "close outbox failed")
+			errs = append(errs, err)
+		}
+	}
+
+	if ctx.Err() != nil {
+		// still give the senders time to flush
+		ctx = context.Background()
+	}
+	for _, sub := range subscribers {
+		if err := sub.remove(ctx); err != nil {
+			log.Error(err, "close sender failed", "id", sub.ID)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// use records a delivery in flight with the subscriber
+func (s subscriber) use() {
+	s.usage.mu.Lock()
+	defer s.usage.mu.Unlock()
+	s.usage.n++
+}
+
+// release ends a delivery, closing the senders of the subscriber when removed
+// and no longer used
+func (s subscriber) release(ctx context.Context) {
+	s.usage.mu.Lock()
+	s.usage.n--
+	last := s.usage.removed && s.usage.n == 0 && !s.usage.closed
+	s.usage.closed = s.usage.closed || last
+	s.usage.mu.Unlock()
+	if !last {
+		return
+	}
+	if err := s.close(context.Background()); err != nil {
+		logx.WithName(ctx, "Hook.release").Error(err, "close sender failed", "id", s.ID)
+	}
+}
+
+// remove marks the subscriber as removed and closes its senders when unused
+func (s subscriber) remove(ctx context.Context) error {
+	s.usage.mu.Lock()
+	s.usage.removed = true
+	unused := s.usage.n == 0 && !s.usage.closed
+	s.usage.closed = s.usage.closed || unused
+	s.usage.mu.Unlock()
+	if !unused {
+		return nil
+	}
+	return s.close(ctx)
+}
+
+// close closes the senders implementing Closer. Without deadline, each one
+// gets closeTimeout
+func (s subscriber) close(ctx context.Context) error {
+	targets := []target{{URL: s.URL, Sender: s.Sender}}
+	if s.DeadLetter != nil {
+		targets = append(targets, *s.DeadLetter)
+	}
+	var errs []error
+	for _, t := range targets {
+		c, ok := t.Sender.(Closer)
+		if !ok {
+			continue
+		}
+		closeCtx, cancel := ctx, context.CancelFunc(func() {})
+		if _, ok := ctx.Deadline(); !ok {
+			closeCtx, cancel = context.WithTimeout(ctx, closeTimeout)
+		}
+		if err := c.Close(closeCtx); err != nil {
+			errs = append(errs, fmt.Errorf("close %s: %w", t.URL.Redacted(), err))
+		}
+		cancel()
+	}
+	return errors.Join(errs...)
+}
+
+// acquire records a new send unless the Hook is closed
+func (h *Hook) acquire() error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.closed {
+		return ErrClosed
+	}
+	h.wg.Add(1)
+	atomic.AddInt64(&h.pending, 1)
 	return nil
 }
 
-// CleanSubscriber cleans the list of subscriber
-func CleanSubscriber() {
-	subscribers = []subscriber{}
+func (h *Hook) release() {
+	atomic.AddInt64(&h.pending, -1)
+	h.wg.Done()
 }
 
-func isInScope(ctx context.Context, subScope, scope string) bool {
+// matchAll is the scope of a redriven delivery, matched on the first one
+var matchAll = regexp.MustCompile(".*")
 
-	log := logx.WithName(ctx, "Hook.isInScope")
+// compileScope compiles the scope of a subscription, "*" matching every scope.
+// An invalid scope is logged and gives nil, matching nothing
+func compileScope(ctx context.Context, subScope string) *regexp.Regexp {
+	log := logx.WithName(ctx, "Hook.compileScope")
 
 	prefix := ""
 	if subScope == "*" {
@@ -153,14 +672,30 @@ func isInScope(ctx context.Context, subScope, scope string) bool {
 	r, err := regexp.Compile(prefix + subScope)
 	if err != nil {
 		log.Error(err, "Match failed")
-		return false
+		return nil
 	}
-	return r.MatchString(scope)
+	return r
+}
+
+// inScope tells whether the scope given to Send matches the subscriber
+func (s subscriber) inScope(scope string) bool {
+	return s.scope != nil && s.scope.MatchString(scope)
 }
 
 // ResolveUrl from payload content
 func ResolveUrl(ctx context.Context, payload interface{}, URL *url.URL) (*url.URL, error) {
 
+	// the provider templates are expanded per value by the provider
+	rest, held := splitQuery(URL.RawQuery, providerTemplates)
+	urlCopy := *URL
+	urlCopy.RawQuery = rest
+	raw := urlCopy.String()
+	if !strings.Contains(raw, "{{") {
+		// nothing to resolve
+		urlCopy.RawQuery = URL.RawQuery
+		return &urlCopy, nil
+	}
+
 	log := logx.WithName(ctx, "Hook.ResolveUrl")
 
 	payloadAsBin, err := json.Marshal(payload)
@@ -171,7 +706,7 @@ func ResolveUrl(ctx context.Context, payload interface{}, URL *url.URL) (*url.UR
 	var payloadAsInterface interface{}
 	_ = json.Unmarshal(payloadAsBin, &payloadAsInterface)
 
-	t, err := template.New("").Option("missingkey=error").Parse(URL.String())
+	t, err := template.New("").Option("missingkey=error").Parse(raw)
 	if err != nil {
 		log.Error(err, "template parse failed")
 		return nil, err
@@ -184,16 +719,50 @@ func ResolveUrl(ctx context.Context, payload interface{}, URL *url.URL) (*url.UR
 		return nil, err
 	}
 
-	urlCopy, _ := url.Parse(tpl.String())
+	resolved, err := url.Parse(tpl.String())
+	if err != nil {
+		log.Error(err, "resolved url parse failed")
+		return nil, err
+	}
+	if held != "" {
+		if resolved.RawQuery != "" {
+			held = resolved.RawQuery + "&" + held
+		}
+		resolved.RawQuery = held
+	}
+	return resolved, nil
+}
+
+// providerTemplates are the query parameters holding a template the provider
+// executes itself, left as is by ResolveUrl
+var providerTemplates = []string{"header", "topicTemplate", "keyTemplate"}
 
-	return urlCopy, nil
+// splitQuery splits the raw query into the pairs without and with one of the
+// keys, both kept raw
+func splitQuery(rawQuery string, keys []string) (rest, held string) {
+	if rawQuery == "" {
+		return "", ""
+	}
+	var kept, removed []string
+	for _, pair := range strings.Split(rawQuery, "&") {
+		k, _, _ := strings.Cut(pair, "=")
+		if key, err := url.QueryUnescape(k); err == nil && contains(keys, key) {
+			removed = append(removed, pair)
+			continue
+		}
+		kept = append(kept, pair)
+	}
+	return strings.Join(kept, "&"), strings.Join(removed, "&")
 }
 
-// ParseMultiHostURL returns a slice of URL split by host
+// ParseMultiHostURL returns a slice of URL split by host, nil when the URL is
+// malformed. The hosts of a kafka URL are the brokers, checked and given their
+// default port by kafka.ParseBrokers. The hosts of the other schemes are only
+// trimmed
 //
 // Example:
 //
-//	exampleURL := "kafka://rpk-0.rpk.kafka.svc.cluster.local:9092,rpk-1.rpk.kafka.svc.cluster.local:9092,rpk-2.rpk.kafka.svc.cluster.local:9092/?topic=PIPELINE_EVENTS&groupid=cicd"
+//	exampleURL := "kafka://rpk-0.rpk.kafka.svc.cluster.local:9092,rpk-1.rpk.kafka.svc.cluster.local:9092,rpk-2.rpk.kafka.svc.cluster.local:9092/?topic=PIPELINE_EVENTS"
 //	parsedURLs := parseMultiHostURL(exampleURL)
 //	for _, url := range parsedURLs {
 //		fmt.Println(url)
@@ -201,41 +770,84 @@ func ResolveUrl(ctx context.Context, payload interface{}, URL *url.URL) (*url.UR
 //
 // Output:
 //
-//	kafka://rpk-0.rpk.kafka.svc.cluster.local:9092/?topic=PIPELINE_EVENTS&groupid=cicd
-//	kafka://rpk-1.rpk.kafka.svc.cluster.local:9092/?topic=PIPELINE_EVENTS&groupid=cicd
-//	kafka://rpk-2.rpk.kafka.svc.cluster.local:9092/?topic=PIPELINE_EVENTS&groupid=cicd
-//
-// Warning:
-//
-//	the latest trailing `/` at the end of the host[s] is mandatory for that function works properly
+//	kafka://rpk-0.rpk.kafka.svc.cluster.local:9092/?topic=PIPELINE_EVENTS
+//	kafka://rpk-1.rpk.kafka.svc.cluster.local:9092/?topic=PIPELINE_EVENTS
+//	kafka://rpk-2.rpk.kafka.svc.cluster.local:9092/?topic=PIPELINE_EVENTS
 //
 // param: url
 // return: []url
 func ParseMultiHostURL(url string) []string {
-	// Identify the scheme
-	schemeEnd := strings.Index(url, "//")
-	if schemeEnd == -1 {
-		return nil // No scheme found, invalid URL
+	prefix, hosts, rest, ok := cutHosts(url)
+	if !ok {
+		return nil
 	}
+	var list []string
+	if isKafka(url) {
+		brokers, err := kafka.ParseBrokers(hosts)
+		if err != nil {
+			return nil
+		}
+		list = brokers
+	} else {
+		for _, host := range strings.Split(hosts, ",") {
+			host = strings.TrimSpace(host)
+			if host == "" {
+				return nil
+			}
+			list = append(list, host)
+		}
+	}
+	var urls []string
+	for _, host := range list {
+		urls = append(urls, prefix+host+rest)
+	}
+	return urls
+}
 
-	// Extract everything after the scheme
-	afterScheme := url[schemeEnd+2:]
+// cutHosts cuts the raw URL around its comma separated host list, the user
+// info staying in the prefix. ok is false without scheme
+func cutHosts(raw string) (prefix, hosts, rest string, ok bool) {
+	schemeEnd := strings.Index(raw, "://")
+	if schemeEnd == -1 {
+		return "", "", "", false
+	}
+	prefix, afterScheme := raw[:schemeEnd+3], raw[schemeEnd+3:]
 
-	// Split the remaining part into hosts and path
-	parts := strings.SplitN(afterScheme, "/", 2)
-	if len(parts) < 2 {
-		return nil
+	// the host list ends with the path, the query or the fragment
+	hostsEnd := strings.IndexAny(afterScheme, "/?#")
+	if hostsEnd == -1 {
+		hostsEnd = len(afterScheme)
 	}
-	hostsPart := parts[0]
-	rest := "/" + parts[1]
+	hosts, rest = afterScheme[:hostsEnd], afterScheme[hostsEnd:]
+	if at := strings.LastIndex(hosts, "@"); at != -1 {
+		prefix, hosts = prefix+hosts[:at+1], hosts[at+1:]
+	}
+	return prefix, hosts, rest, true
+}
 
-	// Split the hosts part by the comma
-	hosts := strings.Split(hostsPart, ",")
+// isKafka tells whether the raw URL has the kafka scheme
+func isKafka(raw string) bool {
+	scheme, _, found := strings.Cut(raw, "://")
+	return found && strings.EqualFold(scheme, "kafka")
+}
 
-	// Reconstruct individual URLs
-	var urls []string
-	for _, host := range hosts {
-		urls = append(urls, url[:schemeEnd+2]+host+rest)
+// parseURL parses a subscription URL. The brokers of a kafka URL are checked
+// and given their default port by kafka.ParseBrokers first, url.Parse
+// rejecting a broker without port after the first one
+func parseURL(raw string) (*url.URL, error) {
+	if !isKafka(raw) {
+		return url.Parse(raw)
 	}
-	return urls
+	prefix, hosts, rest, _ := cutHosts(raw)
+	brokers, err := kafka.ParseBrokers(hosts)
+	if err != nil {
+		return nil, err
+	}
+	// the URL parser does not know the host lists
+	URL, err := url.Parse(prefix + "localhost" + rest)
+	if err != nil {
+		return nil, err
+	}
+	URL.Host = strings.Join(brokers, ",")
+	return URL, nil
 }
@@ -23,9 +23,12 @@ import (
 	"context"
 	"errors"
 	"net/url"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/w6d-io/hook"
+	"github.com/w6d-io/hook/event"
 
 	"go.uber.org/zap/zapcore"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -69,6 +72,10 @@ var _ = AfterSuite(func() {
 	hook.CleanSubscriber()
 })
 
+func NewTestAllOk() hook.Interface        { return &TestAllOk{} }
+func NewTestSendFail() hook.Interface     { return &TestSendFail{} }
+func NewTestValidateFail() hook.Interface { return &TestValidateFail{} }
+
 type TestAllOk struct{}
 
 func (t *TestAllOk) Init(_ context.Context, _ *url.URL) error                { return nil }
@@ -88,3 +95,166 @@ type TestValidateFail struct{}
 func (t *TestValidateFail) Init(_ context.Context, _ *url.URL) error                { return nil }
 func (t *TestValidateFail) Validate(_ *url.URL) error                               { return errors.New("validate failed") }
 func (t *TestValidateFail) Send(_ context.Context, _ interface{}, _ *url.URL) error { return nil }
+
+// TestRecorder sends the host it was initialized with on Sent
+type TestRecorder struct {
+	Sent chan string
+	host string
+}
+
+func (t *TestRecorder) Init(_ context.Context, URL *url.URL) error { t.host = URL.Host; return nil }
+func (t *TestRecorder) Validate(_ *url.URL) error                  { return nil }
+func (t *TestRecorder) Send(_ context.Context, _ interface{}, _ *url.URL) error {
+	t.Sent <- t.host
+	return nil
+}
+
+// TestBlocking sends once Release is closed, or fails when ctx is done first.
+// It records its Close and the sends in flight at that time
+type TestBlocking struct {
+	Release chan struct{}
+	Closed  chan struct{}
+	// Sending is the number of sends in flight
+	Sending atomic.Int32
+	// SendingOnClose is Sending when Close was called
+	SendingOnClose int32
+}
+
+func (t *TestBlocking) Init(_ context.Context, _ *url.URL) error { return nil }
+func (t *TestBlocking) Validate(_ *url.URL) error                { return nil }
+func (t *TestBlocking) Send(ctx context.Context, _ interface{}, _ *url.URL) error {
+	t.Sending.Add(1)
+	defer t.Sending.Add(-1)
+	select {
+	case <-t.Release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+func (t *TestBlocking) Close(_ context.Context) error {
+	t.SendingOnClose = t.Sending.Load()
+	close(t.Closed)
+	return nil
+}
+
+// TestToggle fails to send while Fail is set
+type TestToggle struct {
+	Fail *atomic.Bool
+}
+
+func (t *TestToggle) Init(_ context.Context, _ *url.URL) error { return nil }
+func (t *TestToggle) Validate(_ *url.URL) error                { return nil }
+func (t *TestToggle) Send(_ context.Context, _ interface{}, _ *url.URL) error {
+	if t.Fail.Load() {
+		return errors.New("send failed")
+	}
+	return nil
+}
+
+// TestInitURL records the URL given to Init
+type TestInitURL struct {
+	URL **url.URL
+}
+
+func (t *TestInitURL) Init(_ context.Context, URL *url.URL) error { *t.URL = URL; return nil }
+func (t *TestInitURL) Validate(_ *url.URL) error                  { return nil }
+func (t *TestInitURL) Send(_ context.Context, _ interface{}, _ *url.URL) error {
+	return nil
+}
+
+// TestContext hands the context of Send to Contexts. Then it waits for the
+// context to be done when Wait is set, or for Release when not nil
+type TestContext struct {
+	Contexts chan context.Context
+	Wait     bool
+	Release  chan struct{}
+}
+
+func (t *TestContext) Init(_ context.Context, _ *url.URL) error { return nil }
+func (t *TestContext) Validate(_ *url.URL) error                { return nil }
+func (t *TestContext) Send(ctx context.Context, _ interface{}, _ *url.URL) error {
+	t.Contexts <- ctx
+	if t.Wait {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	if t.Release != nil {
+		<-t.Release
+	}
+	return nil
+}
+
+// TestContextErr fails with the error of the context, like a provider
+// honouring its cancellation
+type TestContextErr struct{}
+
+func (t *TestContextErr) Init(_ context.Context, _ *url.URL) error { return nil }
+func (t *TestContextErr) Validate(_ *url.URL) error                { return nil }
+func (t *TestContextErr) Send(ctx context.Context, _ interface{}, _ *url.URL) error {
+	return ctx.Err()
+}
+
+// TestPayloads hands the payload to Payloads then waits for Release
+type TestPayloads struct {
+	Payloads chan interface{}
+	Release  chan struct{}
+}
+
+func (t *TestPayloads) Init(_ context.Context, _ *url.URL) error { return nil }
+func (t *TestPayloads) Validate(_ *url.URL) error                { return nil }
+func (t *TestPayloads) Send(_ context.Context, payload interface{}, _ *url.URL) error {
+	t.Payloads <- payload
+	<-t.Release
+	return nil
+}
+
+// TestNotRetryable fails with an error that is not worth retrying
+type TestNotRetryable struct{}
+
+func (t *TestNotRetryable) Init(_ context.Context, _ *url.URL) error { return nil }
+func (t *TestNotRetryable) Validate(_ *url.URL) error                { return nil }
+func (t *TestNotRetryable) Send(_ context.Context, _ interface{}, _ *url.URL) error {
+	return notRetryableError{}
+}
+
+type notRetryableError struct{}
+
+func (notRetryableError) Error() string   { return "not retryable" }
+func (notRetryableError) Retryable() bool { return false }
+
+// TestRetryAfter fails with an error asking to wait before the next attempt
+type TestRetryAfter struct {
+	Wait time.Duration
+}
+
+func (t *TestRetryAfter) Init(_ context.Context, _ *url.URL) error { return nil }
+func (t *TestRetryAfter) Validate(_ *url.URL) error                { return nil }
+func (t *TestRetryAfter) Send(_ context.Context, _ interface{}, _ *url.URL) error {
+	return retryAfterError{wait: t.Wait}
+}
+
+type retryAfterError struct {
+	wait time.Duration
+}
+
+func (e retryAfterError) Error() string             { return "rate limited" }
+func (e retryAfterError) RetryAfter() time.Duration { return e.wait }
+
+// TestDeferred defers the outcome of each send and gives the next of Outcomes
+// in background. Without outcome left, it never gives one
+type TestDeferred struct {
+	Outcomes []error
+	sent     int
+}
+
+func (t *TestDeferred) Init(_ context.Context, _ *url.URL) error { return nil }
+func (t *TestDeferred) Validate(_ *url.URL) error                { return nil }
+func (t *TestDeferred) Send(ctx context.Context, _ interface{}, _ *url.URL) error {
+	ack := event.Defer(ctx)
+	if t.sent < len(t.Outcomes) {
+		go ack(t.Outcomes[t.sent])
+	}
+	t.sent++
+	return nil
+}
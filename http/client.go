@@ -0,0 +1,143 @@
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// defaultClient is used by Send when the provider was not initialized
+var defaultClient = &http.Client{Timeout: defaultTimeout}
+
+// clientOptions are the query parameters of the client of a subscription
+type clientOptions struct {
+	timeout      time.Duration
+	maxIdleConns int
+	idleTimeout  time.Duration
+	// http2 is false when HTTP/2 is turned off
+	http2 bool
+	proxy *url.URL
+}
+
+// parseClient reads the timeout, maxIdleConns, idleTimeout, http2 and proxy
+// query parameters
+func parseClient(URL *url.URL) (clientOptions, error) {
+	query := URL.Query()
+	o := clientOptions{timeout: defaultTimeout, http2: true}
+	if v := query.Get("timeout"); v != "" {
+		timeout, err := parseTimeout(v)
+		if err != nil {
+			return o, err
+		}
+		o.timeout = timeout
+	}
+	if v := query.Get("maxIdleConns"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return o, fmt.Errorf("maxIdleConns %q: expected a positive number", v)
+		}
+		o.maxIdleConns = n
+	}
+	if v := query.Get("idleTimeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return o, fmt.Errorf("idleTimeout: %w", err)
+		}
+		o.idleTimeout = d
+	}
+	if v := query.Get("http2"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return o, fmt.Errorf("http2: %w", err)
+		}
+		o.http2 = enabled
+	}
+	if v := query.Get("proxy"); v != "" {
+		proxy, err := url.Parse(v)
+		if err != nil {
+			return o, fmt.Errorf("proxy: %w", err)
+		}
+		if proxy.Scheme == "" || proxy.Host == "" {
+			return o, fmt.Errorf("proxy %q: expected an absolute URL", proxy.Redacted())
+		}
+		o.proxy = proxy
+	}
+	return o, nil
+}
+
+// newClient builds the client of a subscription. The TLS settings, when not
+// nil, get the transport to reload it on rotation
+func newClient(o clientOptions, t *tlsSettings) *http.Client {
+	client := &http.Client{Timeout: o.timeout}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if o.maxIdleConns > 0 {
+		tr.MaxIdleConns, tr.MaxIdleConnsPerHost = o.maxIdleConns, o.maxIdleConns
+	}
+	if o.idleTimeout > 0 {
+		tr.IdleConnTimeout = o.idleTimeout
+	}
+	if !o.http2 {
+		tr.ForceAttemptHTTP2 = false
+		// a non-nil empty map turns HTTP/2 off
+		tr.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	if o.proxy != nil {
+		tr.Proxy = http.ProxyURL(o.proxy)
+	}
+	if t == nil {
+		client.Transport = tr
+		return client
+	}
+	t.base = tr
+	client.Transport = t
+	return client
+}
+
+// parseTimeout reads a number of seconds or a duration like 500ms
+func parseTimeout(v string) (time.Duration, error) {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	d, durationErr := time.ParseDuration(v)
+	if durationErr != nil {
+		return 0, fmt.Errorf("timeout: %w", durationErr)
+	}
+	return d, nil
+}
+
+// Close releases the idle connections of the subscription
+func (h *HTTP) Close(_ context.Context) error {
+	if h.client == nil {
+		return nil
+	}
+	if h.tls != nil {
+		h.tls.closeIdleConnections()
+		return nil
+	}
+	if tr, ok := h.client.Transport.(*http.Transport); ok {
+		tr.CloseIdleConnections()
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+//go:build !integration
+
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package http_test
+
+import (
+	"context"
+	"net"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/w6d-io/hook/http"
+)
+
+var _ = Describe("Client", func() {
+	subscribe := func(rawURL string) (*http.HTTP, *url.URL) {
+		URL, err := url.Parse(rawURL)
+		Ω(err).To(Succeed())
+		h := &http.HTTP{}
+		Ω(h.Validate(URL)).To(Succeed())
+		Ω(h.Init(context.Background(), URL)).To(Succeed())
+		return h, URL
+	}
+	It("reuses the connections", func() {
+		var conns int32
+		server := httptest.NewUnstartedServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {}))
+		server.Config.ConnState = func(_ net.Conn, state nethttp.ConnState) {
+			if state == nethttp.StateNew {
+				atomic.AddInt32(&conns, 1)
+			}
+		}
+		server.Start()
+		defer server.Close()
+		h, URL := subscribe(server.URL + "?maxIdleConns=4&idleTimeout=1m")
+		for i := 0; i < 5; i++ {
+			Ω(h.Send(context.Background(), "message", URL)).To(Succeed())
+		}
+		Ω(atomic.LoadInt32(&conns)).To(Equal(int32(1)))
+		Ω(h.Close(context.Background())).To(Succeed())
+	})
+	It("toggles HTTP/2", func() {
+		protocols := make(chan int, 1)
+		server := httptest.NewUnstartedServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			protocols <- r.ProtoMajor
+		}))
+		server.EnableHTTP2 = true
+		server.StartTLS()
+		defer server.Close()
+		h, URL := subscribe(server.URL + "?insecureSkipVerify=true")
+		Ω(h.Send(context.Background(), "message", URL)).To(Succeed())
+		Ω(<-protocols).To(Equal(2))
+		h, URL = subscribe(server.URL + "?insecureSkipVerify=true&http2=false")
+		Ω(h.Send(context.Background(), "message", URL)).To(Succeed())
+		Ω(<-protocols).To(Equal(1))
+	})
+	It("goes through the proxy", func() {
+		hosts := make(chan string, 1)
+		proxy := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			hosts <- r.URL.Host
+		}))
+		defer proxy.Close()
+		h, URL := subscribe("http://hook.example.com/hook?proxy=" + url.QueryEscape(proxy.URL))
+		Ω(h.Send(context.Background(), "message", URL)).To(Succeed())
+		Ω(<-hosts).To(Equal("hook.example.com"))
+	})
+	It("applies the timeout as a duration", func() {
+		release := make(chan struct{})
+		server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			<-release
+		}))
+		defer server.Close()
+		defer close(release)
+		h, URL := subscribe(server.URL + "?timeout=100ms")
+		start := time.Now()
+		Ω(h.Send(context.Background(), "message", URL)).To(MatchError(ContainSubstring("Client.Timeout")))
+		Ω(time.Since(start)).To(BeNumerically("<", time.Second))
+	})
+	DescribeTable("rejects bad client parameters",
+		func(rawQuery string) {
+			URL, _ := url.Parse("http://localhost" + rawQuery)
+			Ω((&http.HTTP{}).Validate(URL)).ToNot(Succeed())
+			Ω((&http.HTTP{}).Init(context.Background(), URL)).ToNot(Succeed())
+		},
+		Entry("no max idle connections", "?maxIdleConns=0"),
+		Entry("bad idle timeout", "?idleTimeout=soon"),
+		Entry("bad http2 flag", "?http2=maybe"),
+		Entry("relative proxy", "?proxy=proxy.local"),
+	)
+})
@@ -0,0 +1,97 @@
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// the zstd encoder is shared by the subscriptions, EncodeAll is safe for
+// concurrent use
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdErr     error
+)
+
+// sharedZstdEncoder returns the zstd encoder, created on first use
+func sharedZstdEncoder() (*zstd.Encoder, error) {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil)
+	})
+	return zstdEncoder, zstdErr
+}
+
+// parseCompression reads the compress and compressThreshold query parameters
+func parseCompression(URL *url.URL) (compression, error) {
+	query := URL.Query()
+	c := compression{
+		algorithm: query.Get("compress"),
+		threshold: defaultCompressThreshold,
+	}
+	switch c.algorithm {
+	case "", compressGzip:
+	case compressZstd:
+		if _, err := sharedZstdEncoder(); err != nil {
+			return c, fmt.Errorf("zstd encoder: %w", err)
+		}
+	default:
+		return c, fmt.Errorf("compress %q not supported", c.algorithm)
+	}
+	if v := query.Get("compressThreshold"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return c, fmt.Errorf("compressThreshold %q: expected a number of bytes", v)
+		}
+		c.threshold = n
+	}
+	return c, nil
+}
+
+// apply returns the body to send and its content encoding, empty when the
+// body is sent as is
+func (c compression) apply(data []byte) ([]byte, string, error) {
+	if c.algorithm == "" || len(data) < c.threshold {
+		return data, "", nil
+	}
+	switch c.algorithm {
+	case compressZstd:
+		encoder, err := sharedZstdEncoder()
+		if err != nil {
+			return nil, "", err
+		}
+		return encoder.EncodeAll(data, make([]byte, 0, len(data)/2)), compressZstd, nil
+	default:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, "", err
+		}
+		if err := w.Close(); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), compressGzip, nil
+	}
+}
@@ -0,0 +1,113 @@
+//go:build !integration
+
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package http_test
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/w6d-io/hook/http"
+)
+
+var _ = Describe("Compression", func() {
+	type received struct {
+		encoding string
+		size     int
+		payload  string
+	}
+	var (
+		server   *httptest.Server
+		requests chan received
+	)
+	BeforeEach(func() {
+		requests = make(chan received, 1)
+		server = httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			raw, err := io.ReadAll(r.Body)
+			Ω(err).To(Succeed())
+			var reader io.Reader = strings.NewReader(string(raw))
+			switch r.Header.Get("Content-Encoding") {
+			case "gzip":
+				reader, err = gzip.NewReader(reader)
+				Ω(err).To(Succeed())
+			case "zstd":
+				reader, err = zstd.NewReader(reader)
+				Ω(err).To(Succeed())
+			}
+			var payload string
+			Ω(json.NewDecoder(reader).Decode(&payload)).To(Succeed())
+			requests <- received{encoding: r.Header.Get("Content-Encoding"), size: len(raw), payload: payload}
+		}))
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+	send := func(rawQuery, payload string) received {
+		URL, err := url.Parse(server.URL + rawQuery)
+		Ω(err).To(Succeed())
+		h := &http.HTTP{}
+		Ω(h.Validate(URL)).To(Succeed())
+		Ω(h.Init(context.Background(), URL)).To(Succeed())
+		Ω(h.Send(context.Background(), payload, URL)).To(Succeed())
+		return <-requests
+	}
+	large := strings.Repeat("manifest ", 1000)
+	DescribeTable("compresses the large bodies",
+		func(algorithm string) {
+			r := send("?compress="+algorithm, large)
+			Ω(r.encoding).To(Equal(algorithm))
+			Ω(r.size).To(BeNumerically("<", len(large)/10))
+			Ω(r.payload).To(Equal(large))
+		},
+		Entry("gzip", "gzip"),
+		Entry("zstd", "zstd"),
+	)
+	It("sends the small bodies as is", func() {
+		r := send("?compress=gzip", "message")
+		Ω(r.encoding).To(BeEmpty())
+		Ω(r.payload).To(Equal("message"))
+	})
+	It("applies the threshold", func() {
+		Ω(send("?compress=gzip&compressThreshold=0", "message").encoding).To(Equal("gzip"))
+		Ω(send("?compress=gzip&compressThreshold=100000", large).encoding).To(BeEmpty())
+	})
+	It("does not compress by default", func() {
+		Ω(send("", large).encoding).To(BeEmpty())
+	})
+	DescribeTable("rejects bad compression parameters",
+		func(rawQuery string) {
+			URL, _ := url.Parse("http://localhost" + rawQuery)
+			Ω((&http.HTTP{}).Validate(URL)).ToNot(Succeed())
+			Ω((&http.HTTP{}).Init(context.Background(), URL)).ToNot(Succeed())
+		},
+		Entry("unknown algorithm", "?compress=br"),
+		Entry("bad threshold", "?compress=gzip&compressThreshold=-1"),
+	)
+})
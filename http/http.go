@@ -21,39 +21,88 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"os"
 	"strconv"
+	"strings"
+	"text/template"
 	"time"
 
-	"github.com/avast/retry-go"
+	"github.com/google/uuid"
+
+	"github.com/w6d-io/hook/event"
+	"github.com/w6d-io/hook/signature"
 
 	"github.com/w6d-io/x/logx"
 )
 
 func (h *HTTP) Init(ctx context.Context, URL *url.URL) error {
+	log := logx.WithName(ctx, "HTTP.Init")
+
+	accepted, err := parseStatusCodes(URL.Query().Get("acceptedStatus"))
+	if err != nil {
+		log.Error(err, "parse accepted status failed")
+		return err
+	}
+	h.accepted = accepted
+	h.auth, err = parseAuth(URL)
+	if err != nil {
+		log.Error(err, "parse auth failed")
+		return err
+	}
+	h.method, err = parseMethod(URL)
+	if err != nil {
+		log.Error(err, "parse method failed")
+		return err
+	}
+	h.headers, err = parseHeaders(URL)
+	if err != nil {
+		log.Error(err, "parse headers failed")
+		return err
+	}
+	h.sign, h.secretFile, err = parseSignature(URL)
+	if err != nil {
+		log.Error(err, "parse signature failed")
+		return err
+	}
+	h.tls, err = parseTLS(URL)
+	if err != nil {
+		log.Error(err, "parse tls failed")
+		return err
+	}
+	if h.tls != nil {
+		if _, err := h.tls.config(); err != nil {
+			log.Error(err, "load tls failed")
+			return err
+		}
+	}
+	options, err := parseClient(URL)
+	if err != nil {
+		log.Error(err, "parse client failed")
+		return err
+	}
+	h.client = newClient(options, h.tls)
+	if h.auth.oauth != nil {
+		h.auth.oauth.client = h.client
+	}
+	h.compression, err = parseCompression(URL)
+	if err != nil {
+		log.Error(err, "parse compression failed")
+		return err
+	}
 	return nil
 }
 
 func (h *HTTP) Send(ctx context.Context, payload interface{}, URL *url.URL) error {
 	log := logx.WithName(ctx, "Send").WithValues("URL", URL.Redacted())
-	h.Username = URL.User.Username()
-	h.Password, _ = URL.User.Password()
-	query := URL.Query()
-	to, ok := query["timeout"]
-	client := http.Client{
-		Timeout: 5 * time.Second,
-	}
-	if ok {
-		n, err := strconv.ParseInt(to[0], 10, 64)
-		if err != nil {
-			log.Error(err, "convert timeout failed")
-			return err
-		}
-		client = http.Client{
-			Timeout: time.Duration(n) * time.Second,
-		}
+	client := h.client
+	if client == nil {
+		client = defaultClient
 	}
 	log.V(1).Info("marshal payload")
 	data, err := json.Marshal(payload)
@@ -61,35 +110,393 @@ func (h *HTTP) Send(ctx context.Context, payload interface{}, URL *url.URL) erro
 		log.Error(err, "marshal failed")
 		return err
 	}
-	if err := retry.Do(
-		func() error {
-			log.V(1).Info("post payload", "attempt", retry.DefaultAttempts)
-			response, err := client.Post(URL.String(), "application/json", bytes.NewBuffer(data))
-			if err == nil {
-				defer func() {
-					if err := response.Body.Close(); err != nil {
-						log.Error(err, "close http response")
-						return
-					}
-				}()
-				body, err := ioutil.ReadAll(response.Body)
-				if err != nil {
-					log.Error(err, "get response body")
-				}
-				log.Info(string(body))
-				return nil
-			}
-			log.Error(err, "post data failed")
-			return err
-		},
-		retry.Attempts(5),
-	); err != nil {
+	body, encoding, err := h.compression.apply(data)
+	if err != nil {
+		log.Error(err, "compress failed")
+		return err
+	}
+	log.V(1).Info("post payload", "size", len(data), "encoding", encoding)
+	response, err := h.do(ctx, client, URL, data, body, encoding)
+	if err == nil && response.StatusCode == http.StatusUnauthorized && h.auth.oauth != nil {
+		// the token may have been revoked, retry once with a fresh one
+		log.V(1).Info("token refused, fetch a new one")
+		h.auth.oauth.invalidate(bearer(response.Request))
+		_ = response.Body.Close()
+		response, err = h.do(ctx, client, URL, data, body, encoding)
+	}
+	if err != nil {
+		log.Error(err, "post data failed")
+		return err
+	}
+	defer func() {
+		if err := response.Body.Close(); err != nil {
+			log.Error(err, "close http response")
+			return
+		}
+	}()
+	responseBody, err := ioutil.ReadAll(io.LimitReader(response.Body, maxBodySize))
+	if err != nil {
+		log.Error(err, "get response body")
+	}
+	log.Info(string(responseBody))
+	if !h.isAccepted(response.StatusCode) {
+		err := &StatusError{
+			Code:   response.StatusCode,
+			Status: response.Status,
+			Wait:   retryAfter(response.Header, time.Now()),
+		}
+		log.Error(err, "unexpected status")
+		return err
+	}
+	return nil
+}
+
+// do builds the request and sends it. data is the json payload, body is the
+// payload in the content encoding
+func (h *HTTP) do(ctx context.Context, client *http.Client, URL *url.URL, data, body []byte, encoding string) (*http.Response, error) {
+	method := h.method
+	if method == "" {
+		method = http.MethodPost
+	}
+	request, err := http.NewRequestWithContext(ctx, method, target(URL).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if encoding != "" {
+		request.Header.Set("Content-Encoding", encoding)
+	}
+	if err := h.setHeaders(request, data); err != nil {
+		return nil, err
+	}
+	if err := h.auth.apply(request, URL.User); err != nil {
+		return nil, err
+	}
+	// the signature covers the body as sent
+	if err := h.signRequest(ctx, request, body); err != nil {
+		return nil, err
+	}
+	return client.Do(request)
+}
+
+func (HTTP) Validate(URL *url.URL) error {
+	if URL == nil {
+		return nil
+	}
+	if _, err := parseStatusCodes(URL.Query().Get("acceptedStatus")); err != nil {
+		return err
+	}
+	if _, err := parseAuth(URL); err != nil {
+		return err
+	}
+	if _, err := parseMethod(URL); err != nil {
+		return err
+	}
+	if _, err := parseHeaders(URL); err != nil {
 		return err
 	}
+	if _, _, err := parseSignature(URL); err != nil {
+		return err
+	}
+	if _, err := parseTLS(URL); err != nil {
+		return err
+	}
+	if _, err := parseClient(URL); err != nil {
+		return err
+	}
+	_, err := parseCompression(URL)
+	return err
+}
+
+// parseSignature reads the signature and secretFile query parameters
+func parseSignature(URL *url.URL) (string, string, error) {
+	query := URL.Query()
+	scheme, secretFile := strings.ToLower(query.Get("signature")), query.Get("secretFile")
+	if scheme == "" {
+		return "", "", nil
+	}
+	if !signature.Supported(scheme) {
+		return "", "", fmt.Errorf("signature %q not supported", scheme)
+	}
+	if secretFile == "" {
+		return "", "", errors.New("signature without secretFile")
+	}
+	return scheme, secretFile, nil
+}
 
+// signRequest sets the signature headers of the body. The id of the event in
+// ctx is used as webhook-id so it stays the same across the retries
+func (h *HTTP) signRequest(ctx context.Context, request *http.Request, body []byte) error {
+	if h.sign == "" {
+		return nil
+	}
+	raw, err := readToken(h.secretFile)
+	if err != nil {
+		return err
+	}
+	key, err := signature.Secret(raw)
+	if err != nil {
+		return err
+	}
+	id := event.ID(ctx)
+	if id == "" {
+		id = uuid.New().String()
+	}
+	return signature.Sign(request.Header, h.sign, key, id, time.Now(), body)
+}
+
+// parseMethod reads the method query parameter
+func parseMethod(URL *url.URL) (string, error) {
+	method := strings.ToUpper(URL.Query().Get("method"))
+	if method == "" {
+		return http.MethodPost, nil
+	}
+	for _, m := range methods {
+		if m == method {
+			return method, nil
+		}
+	}
+	return "", fmt.Errorf("method %q not supported", method)
+}
+
+// parseHeaders reads the header query parameters, formatted as name:value.
+// The value is a template executed with the payload
+//
+// Example:
+//
+//	?header=X-Event-Type:{{.kind}}&header=X-Source:hook
+func parseHeaders(URL *url.URL) ([]header, error) {
+	var headers []header
+	for _, raw := range URL.Query()["header"] {
+		name, value, ok := strings.Cut(raw, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("header %q: expected name:value", raw)
+		}
+		t, err := template.New(name).Option("missingkey=error").Parse(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("header %q: %w", name, err)
+		}
+		headers = append(headers, header{name: http.CanonicalHeaderKey(name), value: t})
+	}
+	return headers, nil
+}
+
+// setHeaders adds the subscription headers to the request, data is the json
+// payload
+func (h *HTTP) setHeaders(request *http.Request, data []byte) error {
+	if len(h.headers) == 0 {
+		return nil
+	}
+	var payload interface{}
+	_ = json.Unmarshal(data, &payload)
+	for _, hd := range h.headers {
+		var value strings.Builder
+		if err := hd.value.Execute(&value, payload); err != nil {
+			return fmt.Errorf("header %s: %w", hd.name, err)
+		}
+		request.Header.Set(hd.name, value.String())
+	}
 	return nil
 }
 
-func (HTTP) Validate(_ *url.URL) error {
+// parseAuth reads the auth, tokenFile and apiKeyHeader query parameters. The
+// basic auth is used when the URL has a user info and no other auth is set
+func parseAuth(URL *url.URL) (auth, error) {
+	query := URL.Query()
+	a := auth{
+		scheme:       strings.ToLower(query.Get("auth")),
+		tokenFile:    query.Get("tokenFile"),
+		apiKeyHeader: query.Get("apiKeyHeader"),
+	}
+	switch a.scheme {
+	case "":
+		if URL.User != nil && a.apiKeyHeader == "" {
+			a.scheme = authBasic
+		}
+	case authBasic:
+		if URL.User == nil {
+			return a, errors.New("basic auth without user info")
+		}
+	case authBearer:
+		if a.tokenFile == "" {
+			return a, errors.New("bearer auth without tokenFile")
+		}
+	case authOAuth2:
+		var err error
+		if a.oauth, err = parseOAuth2(query); err != nil {
+			return a, err
+		}
+	default:
+		return a, fmt.Errorf("auth %q not supported", a.scheme)
+	}
+	if a.apiKeyHeader != "" {
+		if a.scheme != "" {
+			return a, fmt.Errorf("apiKeyHeader with %s auth", a.scheme)
+		}
+		if a.tokenFile == "" {
+			return a, errors.New("apiKeyHeader without tokenFile")
+		}
+	}
+	return a, nil
+}
+
+// apply sets the credentials on the request
+func (a auth) apply(request *http.Request, user *url.Userinfo) error {
+	switch {
+	case a.scheme == authBasic && user != nil:
+		password, _ := user.Password()
+		request.SetBasicAuth(user.Username(), password)
+	case a.scheme == authBearer:
+		token, err := readToken(a.tokenFile)
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Authorization", "Bearer "+token)
+	case a.scheme == authOAuth2:
+		token, err := a.oauth.token(request.Context())
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Authorization", "Bearer "+token)
+	case a.apiKeyHeader != "":
+		key, err := readToken(a.tokenFile)
+		if err != nil {
+			return err
+		}
+		request.Header.Set(a.apiKeyHeader, key)
+	}
 	return nil
 }
+
+// readToken returns the content of the file without the surrounding spaces
+func readToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("empty token in %s", path)
+	}
+	return token, nil
+}
+
+// isAccepted tells whether the status code means success, 2xx by default
+func (h *HTTP) isAccepted(code int) bool {
+	if len(h.accepted) == 0 {
+		return code >= 200 && code < 300
+	}
+	for _, r := range h.accepted {
+		if code >= r[0] && code <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// parseStatusCodes parses a comma separated list of status codes or ranges
+// of status codes like "200-299,404"
+func parseStatusCodes(raw string) ([][2]int, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var codes [][2]int
+	for _, part := range strings.Split(raw, ",") {
+		low, high, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		if !isRange {
+			high = low
+		}
+		l, err := strconv.Atoi(low)
+		if err != nil {
+			return nil, fmt.Errorf("acceptedStatus %q: %w", part, err)
+		}
+		h, err := strconv.Atoi(high)
+		if err != nil {
+			return nil, fmt.Errorf("acceptedStatus %q: %w", part, err)
+		}
+		if l < 100 || h > 599 || l > h {
+			return nil, fmt.Errorf("acceptedStatus %q: invalid status code", part)
+		}
+		codes = append(codes, [2]int{l, h})
+	}
+	return codes, nil
+}
+
+// retryAfter returns the delay asked by the server through the Retry-After
+// header, in seconds or as an HTTP-date, or else through the RateLimit-Reset
+// or X-RateLimit-Reset header, in seconds or as a unix timestamp
+func retryAfter(header http.Header, now time.Time) time.Duration {
+	if v := strings.TrimSpace(header.Get("Retry-After")); v != "" {
+		if seconds, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return positive(time.Duration(seconds) * time.Second)
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return positive(t.Sub(now))
+		}
+	}
+	for _, key := range []string{"RateLimit-Reset", "X-RateLimit-Reset"} {
+		seconds, err := strconv.ParseInt(strings.TrimSpace(header.Get(key)), 10, 64)
+		if err != nil {
+			continue
+		}
+		if seconds >= epochThreshold {
+			return positive(time.Unix(seconds, 0).Sub(now))
+		}
+		return positive(time.Duration(seconds) * time.Second)
+	}
+	return 0
+}
+
+func positive(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// target returns a copy of the URL without the user info and the query
+// parameters configuring the provider, the others are kept as is
+func target(URL *url.URL) *url.URL {
+	t := *URL
+	// the credentials go in the Authorization header
+	t.User = nil
+	if t.RawQuery == "" {
+		return &t
+	}
+	var kept []string
+	for _, pair := range strings.Split(t.RawQuery, "&") {
+		k, _, _ := strings.Cut(pair, "=")
+		if key, err := url.QueryUnescape(k); err == nil && isParam(key) {
+			continue
+		}
+		kept = append(kept, pair)
+	}
+	t.RawQuery = strings.Join(kept, "&")
+	return &t
+}
+
+func isParam(key string) bool {
+	for _, p := range params {
+		if p == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Error returns the status of the response
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %s", e.Status)
+}
+
+// RetryAfter returns the delay asked by the server before the next attempt
+func (e *StatusError) RetryAfter() time.Duration {
+	return e.Wait
+}
+
+// Retryable tells whether the request may succeed later. It is true for the
+// server errors, request timeout and too many requests
+func (e *StatusError) Retryable() bool {
+	return e.Code >= 500 || e.Code == http.StatusRequestTimeout || e.Code == http.StatusTooManyRequests
+}
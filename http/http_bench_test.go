@@ -0,0 +1,104 @@
+//go:build !integration
+
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package http_test
+
+import (
+	"context"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/w6d-io/hook/http"
+)
+
+type benchPayload struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+func benchmarkSend(b *testing.B, rawQuery string, parallel bool) {
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {}))
+	defer server.Close()
+	URL, err := url.Parse(server.URL + rawQuery)
+	if err != nil {
+		b.Fatal(err)
+	}
+	h := &http.HTTP{}
+	if err := h.Init(context.Background(), URL); err != nil {
+		b.Fatal(err)
+	}
+	defer func() { _ = h.Close(context.Background()) }()
+	payload := benchPayload{Name: "payload", Kind: "bench"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	if !parallel {
+		for i := 0; i < b.N; i++ {
+			if err := h.Send(context.Background(), payload, URL); err != nil {
+				b.Fatal(err)
+			}
+		}
+		return
+	}
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := h.Send(context.Background(), payload, URL); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkSend(b *testing.B) {
+	benchmarkSend(b, "", false)
+}
+
+func BenchmarkSendParallel(b *testing.B) {
+	benchmarkSend(b, "?maxIdleConns=64", true)
+}
+
+// BenchmarkSendNewClient builds the client on each send, without connection
+// reuse
+func BenchmarkSendNewClient(b *testing.B) {
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {}))
+	defer server.Close()
+	URL, err := url.Parse(server.URL)
+	if err != nil {
+		b.Fatal(err)
+	}
+	payload := benchPayload{Name: "payload", Kind: "bench"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			h := &http.HTTP{}
+			if err := h.Init(context.Background(), URL); err != nil {
+				b.Error(err)
+				return
+			}
+			if err := h.Send(context.Background(), payload, URL); err != nil {
+				b.Error(err)
+				return
+			}
+			_ = h.Close(context.Background())
+		}
+	})
+}
@@ -21,12 +21,23 @@ package http_test
 
 import (
 	"context"
+	"errors"
+	"io"
+	nethttp "net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/w6d-io/hook/event"
 	"github.com/w6d-io/hook/http"
+	"github.com/w6d-io/hook/signature"
 )
 
 var _ = Describe("HTTP", func() {
@@ -45,29 +56,331 @@ var _ = Describe("HTTP", func() {
 			err := h.Init(context.Background(), url)
 			Expect(err).To(Succeed())
 		})
-		It("all attempts failed", func() {
+		It("connection failed", func() {
 			h := http.HTTP{}
 			URL, err := url.Parse("http://localhost:1234")
 			Ω(err).To(Succeed())
 			err = h.Send(context.Background(), "message", URL)
 			Ω(err).ToNot(Succeed())
-			Ω(err.Error()).To(ContainSubstring("All attempts fail"))
+			Ω(err.Error()).To(ContainSubstring("connection refused"))
 		})
 		It("test timeout", func() {
 			h := http.HTTP{}
-			URL, err := url.Parse("http://localhost:1234?timeout=120")
+			URL, err := url.Parse("http://localhost:1234?timeout=-")
 			Ω(err).To(Succeed())
+			err = h.Init(context.Background(), URL)
+			Ω(err).To(MatchError(ContainSubstring(`timeout: time: invalid duration "-"`)))
+		})
+		It("times out on a slow server", func() {
+			release := make(chan struct{})
+			server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+				<-release
+			}))
+			defer server.Close()
+			defer close(release)
+			h := http.HTTP{}
+			URL, err := url.Parse(server.URL + "?timeout=50ms")
+			Ω(err).To(Succeed())
+			Ω(h.Init(context.Background(), URL)).To(Succeed())
+			start := time.Now()
 			err = h.Send(context.Background(), "message", URL)
-			Ω(err).ToNot(Succeed())
-			Ω(err.Error()).To(ContainSubstring("All attempts fail"))
+			Ω(err).To(MatchError(ContainSubstring("Client.Timeout exceeded")))
+			Ω(time.Since(start)).To(BeNumerically("<", time.Second))
 		})
 		It("test bad timeout", func() {
 			h := http.HTTP{}
 			URL, err := url.Parse("http://localhost:1234?timeout=s0")
 			Ω(err).To(Succeed())
-			err = h.Send(context.Background(), "message", URL)
+			Ω(h.Validate(URL)).ToNot(Succeed())
+			err = h.Init(context.Background(), URL)
 			Ω(err).ToNot(Succeed())
-			Ω(err.Error()).To(ContainSubstring("invalid syntax"))
+			Ω(err).To(MatchError(ContainSubstring(`timeout: time: invalid duration "s0"`)))
+		})
+		It("stops on context cancellation", func() {
+			release := make(chan struct{})
+			server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+				<-release
+			}))
+			defer server.Close()
+			defer close(release)
+			h := http.HTTP{}
+			URL, err := url.Parse(server.URL)
+			Ω(err).To(Succeed())
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			err = h.Send(ctx, "message", URL)
+			Ω(err).To(MatchError(context.DeadlineExceeded))
+		})
+	})
+	Context("Status", func() {
+		var (
+			server *httptest.Server
+			status int
+			query  string
+			header nethttp.Header
+		)
+		BeforeEach(func() {
+			status = nethttp.StatusOK
+			header = nethttp.Header{}
+			server = httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+				query = r.URL.RawQuery
+				for k, v := range header {
+					w.Header()[k] = v
+				}
+				w.WriteHeader(status)
+			}))
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		send := func(rawQuery string) error {
+			URL, err := url.Parse(server.URL + rawQuery)
+			Ω(err).To(Succeed())
+			h := &http.HTTP{}
+			Ω(h.Validate(URL)).To(Succeed())
+			Ω(h.Init(context.Background(), URL)).To(Succeed())
+			return h.Send(context.Background(), "message", URL)
+		}
+		It("succeeds on 2xx", func() {
+			status = nethttp.StatusAccepted
+			Ω(send("")).To(Succeed())
+		})
+		DescribeTable("fails on the other status",
+			func(code int, retryable bool) {
+				status = code
+				err := send("")
+				var statusErr *http.StatusError
+				Ω(errors.As(err, &statusErr)).To(BeTrue())
+				Ω(statusErr.Code).To(Equal(code))
+				Ω(statusErr.Retryable()).To(Equal(retryable))
+				Ω(err.Error()).To(ContainSubstring(strconv.Itoa(code)))
+			},
+			Entry("server error", nethttp.StatusBadGateway, true),
+			Entry("request timeout", nethttp.StatusRequestTimeout, true),
+			Entry("too many requests", nethttp.StatusTooManyRequests, true),
+			Entry("not found", nethttp.StatusNotFound, false),
+			Entry("redirection", nethttp.StatusNotModified, false),
+		)
+		It("accepts the configured status", func() {
+			status = nethttp.StatusNotFound
+			Ω(send("?acceptedStatus=200-299,404")).To(Succeed())
+			Ω(query).To(BeEmpty())
+			status = nethttp.StatusNoContent
+			Ω(send("?acceptedStatus=200&id=1")).ToNot(Succeed())
+			Ω(query).To(Equal("id=1"))
+		})
+		DescribeTable("gives the delay asked by the server",
+			func(key string, value func() string, min, max time.Duration) {
+				status = nethttp.StatusTooManyRequests
+				header.Set(key, value())
+				var statusErr *http.StatusError
+				Ω(errors.As(send(""), &statusErr)).To(BeTrue())
+				Ω(statusErr.RetryAfter()).To(BeNumerically(">=", min))
+				Ω(statusErr.RetryAfter()).To(BeNumerically("<=", max))
+			},
+			Entry("retry after seconds", "Retry-After", func() string { return "120" }, 120*time.Second, 120*time.Second),
+			Entry("retry after date", "Retry-After", func() string {
+				return time.Now().Add(time.Hour).UTC().Format(nethttp.TimeFormat)
+			}, 58*time.Minute, time.Hour),
+			Entry("retry after past date", "Retry-After", func() string {
+				return time.Now().Add(-time.Hour).UTC().Format(nethttp.TimeFormat)
+			}, time.Duration(0), time.Duration(0)),
+			Entry("rate limit reset seconds", "RateLimit-Reset", func() string { return "30" }, 30*time.Second, 30*time.Second),
+			Entry("rate limit reset timestamp", "X-RateLimit-Reset", func() string {
+				return strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)
+			}, 58*time.Second, time.Minute),
+			Entry("bad value", "Retry-After", func() string { return "soon" }, time.Duration(0), time.Duration(0)),
+		)
+		DescribeTable("rejects bad accepted status",
+			func(value string) {
+				URL, _ := url.Parse("http://localhost?acceptedStatus=" + value)
+				Ω((&http.HTTP{}).Validate(URL)).ToNot(Succeed())
+				Ω((&http.HTTP{}).Init(context.Background(), URL)).ToNot(Succeed())
+			},
+			Entry("not a number", "ok"),
+			Entry("out of range", "200-600"),
+			Entry("reversed range", "299-200"),
+			Entry("bad range end", "200-x"),
+		)
+	})
+	Context("Auth", func() {
+		var (
+			server  *httptest.Server
+			request *nethttp.Request
+			token   string
+		)
+		BeforeEach(func() {
+			server = httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+				request = r
+			}))
+			token = filepath.Join(GinkgoT().TempDir(), "token")
+			Ω(os.WriteFile(token, []byte("secret\n"), 0o600)).To(Succeed())
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		send := func(rawURL string) error {
+			URL, err := url.Parse(rawURL)
+			Ω(err).To(Succeed())
+			h := &http.HTTP{}
+			Ω(h.Validate(URL)).To(Succeed())
+			Ω(h.Init(context.Background(), URL)).To(Succeed())
+			return h.Send(context.Background(), "message", URL)
+		}
+		It("sends the user info as basic auth", func() {
+			URL := strings.Replace(server.URL, "http://", "http://user:pa%3Ass@", 1)
+			Ω(send(URL)).To(Succeed())
+			username, password, ok := request.BasicAuth()
+			Ω(ok).To(BeTrue())
+			Ω(username).To(Equal("user"))
+			Ω(password).To(Equal("pa:ss"))
+		})
+		It("sends the token file as bearer", func() {
+			Ω(send(server.URL + "?auth=bearer&tokenFile=" + token)).To(Succeed())
+			Ω(request.Header.Get("Authorization")).To(Equal("Bearer secret"))
+			Ω(request.URL.RawQuery).To(BeEmpty())
+
+			By("reading the rotated token")
+			Ω(os.WriteFile(token, []byte("rotated"), 0o600)).To(Succeed())
+			Ω(send(server.URL + "?auth=bearer&tokenFile=" + token)).To(Succeed())
+			Ω(request.Header.Get("Authorization")).To(Equal("Bearer rotated"))
+		})
+		It("sends the token file in the API key header", func() {
+			Ω(send(server.URL + "?apiKeyHeader=X-Api-Key&tokenFile=" + token)).To(Succeed())
+			Ω(request.Header.Get("X-Api-Key")).To(Equal("secret"))
+			Ω(request.Header.Get("Authorization")).To(BeEmpty())
+		})
+		It("fails when the token file is missing", func() {
+			Ω(send(server.URL + "?auth=bearer&tokenFile=" + token + ".missing")).ToNot(Succeed())
+		})
+		DescribeTable("rejects bad auth",
+			func(rawURL string) {
+				URL, _ := url.Parse(rawURL)
+				Ω((&http.HTTP{}).Validate(URL)).ToNot(Succeed())
+				Ω((&http.HTTP{}).Init(context.Background(), URL)).ToNot(Succeed())
+			},
+			Entry("unknown scheme", "http://localhost?auth=digest"),
+			Entry("basic without user", "http://localhost?auth=basic"),
+			Entry("bearer without token file", "http://localhost?auth=bearer"),
+			Entry("api key without token file", "http://localhost?apiKeyHeader=X-Api-Key"),
+			Entry("api key with bearer", "http://localhost?auth=bearer&tokenFile=/t&apiKeyHeader=X-Api-Key"),
+		)
+	})
+	Context("Request", func() {
+		var (
+			server  *httptest.Server
+			request *nethttp.Request
+		)
+		BeforeEach(func() {
+			server = httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+				request = r
+			}))
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		send := func(rawQuery string, payload interface{}) error {
+			URL, err := url.Parse(server.URL + rawQuery)
+			Ω(err).To(Succeed())
+			h := &http.HTTP{}
+			Ω(h.Validate(URL)).To(Succeed())
+			Ω(h.Init(context.Background(), URL)).To(Succeed())
+			return h.Send(context.Background(), payload, URL)
+		}
+		It("posts by default", func() {
+			Ω(send("", "message")).To(Succeed())
+			Ω(request.Method).To(Equal(nethttp.MethodPost))
+			Ω(request.Header.Get("Content-Type")).To(Equal("application/json"))
+		})
+		It("uses the method", func() {
+			Ω(send("?method=put", "message")).To(Succeed())
+			Ω(request.Method).To(Equal(nethttp.MethodPut))
+			Ω(send("?method=PATCH", "message")).To(Succeed())
+			Ω(request.Method).To(Equal(nethttp.MethodPatch))
+		})
+		It("adds the static and templated headers", func() {
+			payload := map[string]string{"kind": "push"}
+			query := "?header=" + url.QueryEscape("X-Event-Type: {{.kind}}") + "&header=x-source:hook&id=1"
+			Ω(send(query, payload)).To(Succeed())
+			Ω(request.Header.Get("X-Event-Type")).To(Equal("push"))
+			Ω(request.Header.Get("X-Source")).To(Equal("hook"))
+			Ω(request.URL.RawQuery).To(Equal("id=1"))
+		})
+		It("fails when the template does not apply", func() {
+			query := "?header=" + url.QueryEscape("X-Event-Type:{{.kind}}")
+			Ω(send(query, map[string]string{"name": "test"})).ToNot(Succeed())
+		})
+		DescribeTable("rejects bad request parameters",
+			func(rawQuery string) {
+				URL, _ := url.Parse("http://localhost" + rawQuery)
+				Ω((&http.HTTP{}).Validate(URL)).ToNot(Succeed())
+				Ω((&http.HTTP{}).Init(context.Background(), URL)).ToNot(Succeed())
+			},
+			Entry("unsupported method", "?method=DELETE"),
+			Entry("header without value", "?header=X-Source"),
+			Entry("header without name", "?header=:value"),
+			Entry("bad template", "?header="+url.QueryEscape("X-Event-Type:{{.kind")),
+		)
+	})
+	Context("Signature", func() {
+		var (
+			server  *httptest.Server
+			request *nethttp.Request
+			body    []byte
+			secret  string
+		)
+		BeforeEach(func() {
+			server = httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+				request = r
+				body, _ = io.ReadAll(r.Body)
+			}))
+			secret = filepath.Join(GinkgoT().TempDir(), "secret")
+			Ω(os.WriteFile(secret, []byte("whsec_c2VjcmV0\n"), 0o600)).To(Succeed())
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		send := func(ctx context.Context, rawQuery string) error {
+			URL, err := url.Parse(server.URL + rawQuery)
+			Ω(err).To(Succeed())
+			h := &http.HTTP{}
+			Ω(h.Validate(URL)).To(Succeed())
+			Ω(h.Init(ctx, URL)).To(Succeed())
+			return h.Send(ctx, "message", URL)
+		}
+		It("signs following Standard Webhooks", func() {
+			ctx := event.WithID(context.Background(), "msg_1")
+			Ω(send(ctx, "?signature=standard&secretFile="+secret)).To(Succeed())
+			Ω(request.Header.Get(signature.HeaderID)).To(Equal("msg_1"))
+			timestamp, err := strconv.ParseInt(request.Header.Get(signature.HeaderTimestamp), 10, 64)
+			Ω(err).To(Succeed())
+			Ω(request.Header.Get(signature.HeaderSignature)).To(Equal(
+				signature.StandardSignature([]byte("secret"), "msg_1", time.Unix(timestamp, 0), body)))
+			Ω(request.Header.Get(signature.HeaderHub)).To(BeEmpty())
+		})
+		It("signs with an id without event", func() {
+			Ω(send(context.Background(), "?signature=standard&secretFile="+secret)).To(Succeed())
+			Ω(request.Header.Get(signature.HeaderID)).ToNot(BeEmpty())
+		})
+		It("signs following GitHub", func() {
+			Ω(os.WriteFile(secret, []byte("secret"), 0o600)).To(Succeed())
+			Ω(send(context.Background(), "?signature=github&secretFile="+secret)).To(Succeed())
+			Ω(request.Header.Get(signature.HeaderHub)).To(Equal(signature.HubSignature([]byte("secret"), body)))
+			Ω(request.Header.Get(signature.HeaderSignature)).To(BeEmpty())
+			Ω(request.Header.Get(signature.HeaderDelivery)).ToNot(BeEmpty())
+			Ω(request.URL.RawQuery).To(BeEmpty())
+		})
+		It("fails when the secret file is missing", func() {
+			Ω(send(context.Background(), "?signature=github&secretFile="+secret+".missing")).ToNot(Succeed())
 		})
+		DescribeTable("rejects bad signature parameters",
+			func(rawQuery string) {
+				URL, _ := url.Parse("http://localhost" + rawQuery)
+				Ω((&http.HTTP{}).Validate(URL)).ToNot(Succeed())
+				Ω((&http.HTTP{}).Init(context.Background(), URL)).ToNot(Succeed())
+			},
+			Entry("unknown scheme", "?signature=md5&secretFile=/s"),
+			Entry("no secret file", "?signature=standard"),
+		)
 	})
 })
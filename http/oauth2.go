@@ -0,0 +1,102 @@
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// parseOAuth2 reads the tokenUrl, clientId, clientSecretFile and scopes query
+// parameters of the oauth2 auth
+func parseOAuth2(query url.Values) (*oauthSource, error) {
+	s := &oauthSource{
+		tokenURL:   query.Get("tokenUrl"),
+		clientID:   query.Get("clientId"),
+		secretFile: query.Get("clientSecretFile"),
+	}
+	if s.tokenURL == "" || s.clientID == "" || s.secretFile == "" {
+		return nil, errors.New("oauth2 auth needs tokenUrl, clientId and clientSecretFile")
+	}
+	tokenURL, err := url.Parse(s.tokenURL)
+	if err != nil {
+		return nil, fmt.Errorf("tokenUrl: %w", err)
+	}
+	if tokenURL.Scheme == "" || tokenURL.Host == "" {
+		return nil, fmt.Errorf("tokenUrl %q: expected an absolute URL", tokenURL.Redacted())
+	}
+	for _, scope := range strings.Split(query.Get("scopes"), ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			s.scopes = append(s.scopes, scope)
+		}
+	}
+	return s, nil
+}
+
+// token returns the cached access token, or fetches a new one when there is
+// none or when it expires within the refresh margin
+func (s *oauthSource) token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current != nil && (s.current.Expiry.IsZero() || time.Until(s.current.Expiry) > tokenRefreshMargin) {
+		return s.current.AccessToken, nil
+	}
+	// the secret file is read on each fetch so it can be rotated
+	secret, err := readToken(s.secretFile)
+	if err != nil {
+		return "", err
+	}
+	config := clientcredentials.Config{
+		ClientID:     s.clientID,
+		ClientSecret: secret,
+		TokenURL:     s.tokenURL,
+		Scopes:       s.scopes,
+	}
+	if s.client != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, s.client)
+	}
+	t, err := config.Token(ctx)
+	if err != nil {
+		return "", fmt.Errorf("fetch oauth2 token: %w", err)
+	}
+	s.current = t
+	return t.AccessToken, nil
+}
+
+// invalidate forgets the token refused by the target, unless it was already
+// replaced
+func (s *oauthSource) invalidate(refused string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current != nil && s.current.AccessToken == refused {
+		s.current = nil
+	}
+}
+
+// bearer returns the token of the Authorization header of the request
+func bearer(request *http.Request) string {
+	return strings.TrimPrefix(request.Header.Get("Authorization"), "Bearer ")
+}
@@ -0,0 +1,138 @@
+//go:build !integration
+
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package http_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/w6d-io/hook/http"
+)
+
+var _ = Describe("OAuth2", func() {
+	var (
+		tokenServer *httptest.Server
+		server      *httptest.Server
+		fetched     int32
+		expiresIn   int
+		valid       atomic.Value
+		scopes      chan string
+		secret      string
+		requests    int32
+		reject      atomic.Bool
+	)
+	BeforeEach(func() {
+		fetched, expiresIn, requests = 0, 3600, 0
+		reject.Store(false)
+		scopes = make(chan string, 8)
+		valid.Store("")
+		tokenServer = httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			id, password, _ := r.BasicAuth()
+			if id != "hook" || password != "secret" || r.FormValue("grant_type") != "client_credentials" {
+				w.WriteHeader(nethttp.StatusUnauthorized)
+				return
+			}
+			scopes <- r.FormValue("scope")
+			token := fmt.Sprintf("token-%d", atomic.AddInt32(&fetched, 1))
+			valid.Store(token)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprintf(w, `{"access_token":%q,"token_type":"bearer","expires_in":%d}`, token, expiresIn)
+		}))
+		server = httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			atomic.AddInt32(&requests, 1)
+			if reject.Load() || r.Header.Get("Authorization") != "Bearer "+valid.Load().(string) {
+				w.WriteHeader(nethttp.StatusUnauthorized)
+			}
+		}))
+		secret = filepath.Join(GinkgoT().TempDir(), "secret")
+		Ω(os.WriteFile(secret, []byte("secret"), 0o600)).To(Succeed())
+	})
+	AfterEach(func() {
+		server.Close()
+		tokenServer.Close()
+	})
+	subscribe := func(extra string) (*http.HTTP, *url.URL) {
+		URL, err := url.Parse(server.URL + "?auth=oauth2&clientId=hook&clientSecretFile=" + secret +
+			"&tokenUrl=" + url.QueryEscape(tokenServer.URL) + extra)
+		Ω(err).To(Succeed())
+		h := &http.HTTP{}
+		Ω(h.Validate(URL)).To(Succeed())
+		Ω(h.Init(context.Background(), URL)).To(Succeed())
+		return h, URL
+	}
+	It("fetches the token once", func() {
+		h, URL := subscribe("&scopes=hook.write,hook.read")
+		Ω(h.Send(context.Background(), "message", URL)).To(Succeed())
+		Ω(h.Send(context.Background(), "message", URL)).To(Succeed())
+		Ω(atomic.LoadInt32(&fetched)).To(Equal(int32(1)))
+		Ω(<-scopes).To(Equal("hook.write hook.read"))
+	})
+	It("refreshes the token before expiry", func() {
+		expiresIn = 10
+		h, URL := subscribe("")
+		Ω(h.Send(context.Background(), "message", URL)).To(Succeed())
+		Ω(h.Send(context.Background(), "message", URL)).To(Succeed())
+		Ω(atomic.LoadInt32(&fetched)).To(Equal(int32(2)))
+	})
+	It("retries once with a fresh token on 401", func() {
+		h, URL := subscribe("")
+		Ω(h.Send(context.Background(), "message", URL)).To(Succeed())
+		By("revoking the token")
+		valid.Store("revoked")
+		Ω(h.Send(context.Background(), "message", URL)).To(Succeed())
+		Ω(atomic.LoadInt32(&fetched)).To(Equal(int32(2)))
+		Ω(atomic.LoadInt32(&requests)).To(Equal(int32(3)))
+	})
+	It("fails when the fresh token is refused too", func() {
+		reject.Store(true)
+		h, URL := subscribe("")
+		var statusErr *http.StatusError
+		Ω(errors.As(h.Send(context.Background(), "message", URL), &statusErr)).To(BeTrue())
+		Ω(statusErr.Code).To(Equal(nethttp.StatusUnauthorized))
+		Ω(atomic.LoadInt32(&fetched)).To(Equal(int32(2)))
+		Ω(atomic.LoadInt32(&requests)).To(Equal(int32(2)))
+	})
+	It("fails when the token is refused", func() {
+		Ω(os.WriteFile(secret, []byte("wrong"), 0o600)).To(Succeed())
+		h, URL := subscribe("")
+		Ω(h.Send(context.Background(), "message", URL)).To(MatchError(ContainSubstring("oauth2 token")))
+	})
+	DescribeTable("rejects bad oauth2 parameters",
+		func(rawQuery string) {
+			URL, _ := url.Parse("http://localhost?auth=oauth2" + rawQuery)
+			Ω((&http.HTTP{}).Validate(URL)).ToNot(Succeed())
+			Ω((&http.HTTP{}).Init(context.Background(), URL)).ToNot(Succeed())
+		},
+		Entry("without token URL", "&clientId=hook&clientSecretFile=/s"),
+		Entry("without client id", "&tokenUrl=http://auth/token&clientSecretFile=/s"),
+		Entry("without secret file", "&tokenUrl=http://auth/token&clientId=hook"),
+		Entry("relative token URL", "&tokenUrl=auth/token&clientId=hook&clientSecretFile=/s"),
+	)
+})
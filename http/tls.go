@@ -0,0 +1,144 @@
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// parseTLS reads the caFile, certFile, keyFile, serverName and
+// insecureSkipVerify query parameters, nil when none is set. The files are
+// loaded by config
+func parseTLS(URL *url.URL) (*tlsSettings, error) {
+	query := URL.Query()
+	t := &tlsSettings{
+		caFile:     query.Get("caFile"),
+		certFile:   query.Get("certFile"),
+		keyFile:    query.Get("keyFile"),
+		serverName: query.Get("serverName"),
+	}
+	if v := query.Get("insecureSkipVerify"); v != "" {
+		insecure, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("insecureSkipVerify: %w", err)
+		}
+		t.insecure = insecure
+	}
+	if (t.certFile == "") != (t.keyFile == "") {
+		return nil, errors.New("certFile and keyFile go together")
+	}
+	if t.caFile == "" && t.certFile == "" && t.serverName == "" && !t.insecure {
+		return nil, nil
+	}
+	return t, nil
+}
+
+// transport returns the transport using the TLS settings. It is built again
+// when one of the files changed, so the rotated certificates are used
+func (t *tlsSettings) transport() (*http.Transport, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	modTimes, err := t.modTimes()
+	if err != nil {
+		return nil, err
+	}
+	if t.current != nil && modTimes == t.loaded {
+		return t.current, nil
+	}
+	config, err := t.config()
+	if err != nil {
+		return nil, err
+	}
+	tr := t.base.Clone()
+	tr.TLSClientConfig = config
+	if t.current != nil {
+		t.current.CloseIdleConnections()
+	}
+	t.current, t.loaded = tr, modTimes
+	return tr, nil
+}
+
+// RoundTrip sends the request with the transport of the current files
+func (t *tlsSettings) RoundTrip(request *http.Request) (*http.Response, error) {
+	tr, err := t.transport()
+	if err != nil {
+		return nil, err
+	}
+	return tr.RoundTrip(request)
+}
+
+func (t *tlsSettings) closeIdleConnections() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.current != nil {
+		t.current.CloseIdleConnections()
+	}
+}
+
+// config loads the files into a TLS configuration
+func (t *tlsSettings) config() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName: t.serverName,
+		// #nosec G402 -- asked by the subscription
+		InsecureSkipVerify: t.insecure,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if t.caFile != "" {
+		data, err := os.ReadFile(t.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("caFile: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("caFile: no certificate in %s", t.caFile)
+		}
+		config.RootCAs = pool
+	}
+	if t.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.certFile, t.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("certFile: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// modTimes returns the modification time of the files
+func (t *tlsSettings) modTimes() ([3]time.Time, error) {
+	var modTimes [3]time.Time
+	for i, path := range []string{t.caFile, t.certFile, t.keyFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return modTimes, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
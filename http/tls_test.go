@@ -0,0 +1,153 @@
+//go:build !integration
+
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package http_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/w6d-io/hook/http"
+)
+
+// writeCertificate writes a self-signed client certificate and its key in dir
+func writeCertificate(dir, name string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Ω(err).To(Succeed())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Ω(err).To(Succeed())
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	Ω(err).To(Succeed())
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	Ω(os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)).To(Succeed())
+	Ω(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600)).To(Succeed())
+	return certFile, keyFile
+}
+
+var _ = Describe("TLS", func() {
+	var (
+		server  *httptest.Server
+		clients chan string
+		dir     string
+		caFile  string
+	)
+	BeforeEach(func() {
+		clients = make(chan string, 4)
+		server = httptest.NewUnstartedServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			name := ""
+			if len(r.TLS.PeerCertificates) > 0 {
+				name = r.TLS.PeerCertificates[0].Subject.CommonName
+			}
+			clients <- name
+		}))
+		server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+		server.StartTLS()
+		dir = GinkgoT().TempDir()
+		caFile = filepath.Join(dir, "ca.crt")
+		Ω(os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600)).To(Succeed())
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+	subscribe := func(rawURL string) (*http.HTTP, *url.URL) {
+		URL, err := url.Parse(rawURL)
+		Ω(err).To(Succeed())
+		h := &http.HTTP{}
+		Ω(h.Validate(URL)).To(Succeed())
+		Ω(h.Init(context.Background(), URL)).To(Succeed())
+		return h, URL
+	}
+	It("fails on an unknown authority", func() {
+		h, URL := subscribe(server.URL)
+		Ω(h.Send(context.Background(), "message", URL)).To(MatchError(ContainSubstring("certificate")))
+	})
+	It("trusts the CA file", func() {
+		h, URL := subscribe(server.URL + "?caFile=" + caFile)
+		Ω(h.Send(context.Background(), "message", URL)).To(Succeed())
+		Ω(<-clients).To(BeEmpty())
+	})
+	It("skips the verification", func() {
+		h, URL := subscribe(server.URL + "?insecureSkipVerify=true")
+		Ω(h.Send(context.Background(), "message", URL)).To(Succeed())
+	})
+	It("verifies the server name", func() {
+		h, URL := subscribe(server.URL + "?caFile=" + caFile + "&serverName=example.com")
+		Ω(h.Send(context.Background(), "message", URL)).To(Succeed())
+		h, URL = subscribe(server.URL + "?caFile=" + caFile + "&serverName=other.com")
+		Ω(h.Send(context.Background(), "message", URL)).ToNot(Succeed())
+	})
+	It("sends the client certificate and reloads it", func() {
+		certFile, keyFile := writeCertificate(dir, "first")
+		h, URL := subscribe(server.URL + "?caFile=" + caFile + "&certFile=" + certFile + "&keyFile=" + keyFile)
+		Ω(h.Send(context.Background(), "message", URL)).To(Succeed())
+		Ω(<-clients).To(Equal("first"))
+
+		By("rotating the certificate")
+		writeCertificate(dir, "second")
+		later := time.Now().Add(time.Minute)
+		Ω(os.Chtimes(certFile, later, later)).To(Succeed())
+		Ω(h.Send(context.Background(), "message", URL)).To(Succeed())
+		Ω(<-clients).To(Equal("second"))
+	})
+	DescribeTable("rejects bad TLS parameters",
+		func(query func() string) {
+			URL, _ := url.Parse("https://localhost" + query())
+			Ω((&http.HTTP{}).Validate(URL)).ToNot(Succeed())
+			Ω((&http.HTTP{}).Init(context.Background(), URL)).ToNot(Succeed())
+		},
+		Entry("cert without key", func() string { return "?certFile=" + caFile }),
+		Entry("bad insecure flag", func() string { return "?insecureSkipVerify=maybe" }),
+	)
+	DescribeTable("loads the TLS files on Init only",
+		func(query func() string) {
+			URL, _ := url.Parse("https://localhost" + query())
+			Ω((&http.HTTP{}).Validate(URL)).To(Succeed())
+			Ω((&http.HTTP{}).Init(context.Background(), URL)).ToNot(Succeed())
+		},
+		Entry("missing CA file", func() string { return "?caFile=" + caFile + ".missing" }),
+		Entry("CA file without certificate", func() string {
+			Ω(os.WriteFile(caFile, []byte("none"), 0o600)).To(Succeed())
+			return "?caFile=" + caFile
+		}),
+		Entry("bad key pair", func() string { return "?certFile=" + caFile + "&keyFile=" + caFile }),
+	)
+})
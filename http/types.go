@@ -16,7 +16,137 @@ Created on 26/02/2021
 */
 package http
 
+import (
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
 type HTTP struct {
-	Username string
-	Password string
+	// accepted are the ranges of status codes meaning success
+	accepted [][2]int
+	// auth is set at Init and only read afterwards
+	auth auth
+	// method of the requests, POST by default
+	method string
+	// headers are added to every request, their value is a template executed
+	// with the payload
+	headers []header
+	// sign is the signature scheme, no signature when empty
+	sign string
+	// secretFile holds the signing secret, it is read on each Send
+	secretFile string
+	// tls is nil when the subscription uses the default TLS settings
+	tls *tlsSettings
+	// client is built at Init and shared by the sends of the subscription
+	client *http.Client
+	// compression of the request body, none when the algorithm is empty
+	compression compression
+}
+
+// compression compresses the bodies of at least threshold bytes
+type compression struct {
+	algorithm string
+	threshold int
+}
+
+const (
+	compressGzip = "gzip"
+	compressZstd = "zstd"
+	// defaultCompressThreshold is the size in bytes below which a body is
+	// not compressed
+	defaultCompressThreshold = 1024
+)
+
+// tlsSettings are the TLS files and options of a subscription
+type tlsSettings struct {
+	caFile     string
+	certFile   string
+	keyFile    string
+	serverName string
+	insecure   bool
+
+	// base is the transport of the subscription, cloned on each reload
+	base *http.Transport
+
+	mu sync.Mutex
+	// current is the transport built from the files modified at loaded
+	current *http.Transport
+	loaded  [3]time.Time
+}
+
+type header struct {
+	name  string
+	value *template.Template
+}
+
+// auth tells how the requests are authenticated. The basic credentials come
+// from the user info of the URL given to Send
+type auth struct {
+	// scheme is empty, basic or bearer
+	scheme string
+	// tokenFile holds the bearer token or the API key, it is read on each Send
+	// so the secret can be rotated
+	tokenFile string
+	// apiKeyHeader is the header carrying the API key
+	apiKeyHeader string
+	// oauth fetches the tokens of the oauth2 auth
+	oauth *oauthSource
 }
+
+// oauthSource fetches and caches the tokens of the OAuth2 client credentials
+// flow
+type oauthSource struct {
+	tokenURL   string
+	clientID   string
+	secretFile string
+	scopes     []string
+	// client is the client of the subscription, so the token requests use
+	// its TLS and proxy settings
+	client *http.Client
+
+	mu      sync.Mutex
+	current *oauth2.Token
+}
+
+const (
+	authBasic  = "basic"
+	authBearer = "bearer"
+	authOAuth2 = "oauth2"
+)
+
+// tokenRefreshMargin is the time before expiry when an OAuth2 token is
+// fetched again
+const tokenRefreshMargin = 30 * time.Second
+
+// StatusError is returned when the response status code is not accepted
+type StatusError struct {
+	Code   int
+	Status string
+	// Wait is the delay asked by the Retry-After or RateLimit-Reset header,
+	// zero when absent
+	Wait time.Duration
+}
+
+// defaultTimeout bounds the requests without timeout parameter
+const defaultTimeout = 5 * time.Second
+
+// maxBodySize is the maximum size of the response body read
+const maxBodySize = 1 << 20
+
+// epochThreshold separates the reset headers given as a unix timestamp from the
+// ones given as a number of seconds
+const epochThreshold = 1_000_000_000
+
+// params are the query parameters configuring the provider, they are not sent
+// to the target
+var params = []string{"timeout", "acceptedStatus", "auth", "tokenFile", "apiKeyHeader",
+	"tokenUrl", "clientId", "clientSecretFile", "scopes", "method", "header", "signature", "secretFile",
+	"caFile", "certFile", "keyFile", "serverName", "insecureSkipVerify",
+	"maxIdleConns", "idleTimeout", "http2", "proxy", "compress", "compressThreshold"}
+
+// methods are the supported request methods
+var methods = []string{http.MethodPost, http.MethodPut, http.MethodPatch}
@@ -0,0 +1,195 @@
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	ckafka "github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// ProducerConfig builds the producer configuration of a kafka subscription
+// URL. The user info gives the SASL credentials, the query the tuning. An
+// unknown parameter or an invalid value fails
+//
+// Example:
+//
+//	u, _ := url.Parse("kafka://user:pass@b1:9092/?topic=EVENTS&mechanisms=SCRAM-SHA-512&acks=all&compression=zstd")
+//	cfg, err := kafka.ProducerConfig(u)
+func ProducerConfig(URL *url.URL) (ckafka.ConfigMap, error) {
+	query := URL.Query()
+	for key := range query {
+		if !contains(params, key) && !contains(consumerParams, key) {
+			return nil, fmt.Errorf("unknown parameter %q", key)
+		}
+	}
+	brokers, err := ParseBrokers(URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	cfg := ckafka.ConfigMap{"bootstrap.servers": strings.Join(brokers, ",")}
+
+	if err := parseSecurity(cfg, URL, query); err != nil {
+		return nil, err
+	}
+	if err := oneOf(cfg, query, "compression", "compression.type", compressions); err != nil {
+		return nil, err
+	}
+	if err := oneOf(cfg, query, "partitioner", "partitioner", partitioners); err != nil {
+		return nil, err
+	}
+	if err := oneOf(cfg, query, "acks", "acks", acks); err != nil {
+		return nil, err
+	}
+	if err := number(cfg, query, "lingerMs", "linger.ms", 0, 900000); err != nil {
+		return nil, err
+	}
+	if err := number(cfg, query, "batchSize", "batch.size", 1, 2147483647); err != nil {
+		return nil, err
+	}
+	if _, err := parseAsync(query); err != nil {
+		return nil, err
+	}
+	if raw := query.Get("idempotence"); raw != "" {
+		idempotence, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("idempotence %q: not a boolean", raw)
+		}
+		// the idempotent producer needs the acknowledgment of all the replicas
+		if ack := query.Get("acks"); idempotence && ack != "" && ack != "all" && ack != "-1" {
+			return nil, fmt.Errorf("idempotence needs acks=all, got %q", ack)
+		}
+		cfg["enable.idempotence"] = idempotence
+	}
+	return cfg, nil
+}
+
+// parseSecurity sets the protocol, the SASL credentials and the SSL files.
+// The protocol defaults to SASL_SSL with credentials, SSL with files only.
+// Without credentials, a SASL protocol and the mechanisms are ignored, as the
+// producer always did
+func parseSecurity(cfg ckafka.ConfigMap, URL *url.URL, query url.Values) error {
+	protocol := query.Get("protocol")
+	if protocol != "" && !contains(protocols, protocol) {
+		return fmt.Errorf("protocol %q: expected one of %s", protocol, strings.Join(protocols, ", "))
+	}
+	mechanism := query.Get("mechanisms")
+	if mechanism != "" && !contains(mechanisms, mechanism) {
+		return fmt.Errorf("mechanisms %q: expected one of %s", mechanism, strings.Join(mechanisms, ", "))
+	}
+	files := query.Get("caFile") != "" || query.Get("certFile") != "" || query.Get("keyFile") != ""
+	sasl := strings.HasPrefix(protocol, "SASL_")
+	switch {
+	case URL.User != nil && protocol == "":
+		protocol, sasl = "SASL_SSL", true
+	case URL.User != nil && !sasl:
+		return fmt.Errorf("protocol %q: the credentials need SASL_PLAINTEXT or SASL_SSL", protocol)
+	case URL.User == nil && (sasl || protocol == ""):
+		protocol, sasl = "", false
+		if files {
+			protocol = "SSL"
+		}
+	}
+	if protocol != "" {
+		cfg["security.protocol"] = protocol
+	}
+	if sasl {
+		if mechanism == "" {
+			mechanism = "PLAIN"
+		}
+		password, _ := URL.User.Password()
+		cfg["sasl.mechanisms"] = mechanism
+		cfg["sasl.username"] = URL.User.Username()
+		cfg["sasl.password"] = password
+	}
+
+	if !files {
+		return nil
+	}
+	if protocol != "SSL" && protocol != "SASL_SSL" {
+		return fmt.Errorf("protocol %q: caFile, certFile and keyFile need SSL or SASL_SSL", protocol)
+	}
+	if (query.Get("certFile") == "") != (query.Get("keyFile") == "") {
+		return errors.New("certFile and keyFile go together")
+	}
+	for param, key := range map[string]string{
+		"caFile":   "ssl.ca.location",
+		"certFile": "ssl.certificate.location",
+		"keyFile":  "ssl.key.location",
+	} {
+		if file := query.Get(param); file != "" {
+			cfg[key] = file
+		}
+	}
+	return nil
+}
+
+// parseAsync reads the async parameter, false when not set
+func parseAsync(query url.Values) (bool, error) {
+	raw := query.Get("async")
+	if raw == "" {
+		return false, nil
+	}
+	async, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("async %q: not a boolean", raw)
+	}
+	return async, nil
+}
+
+// oneOf sets the configuration key to the parameter value when it is one of
+// the allowed values
+func oneOf(cfg ckafka.ConfigMap, query url.Values, param, key string, allowed []string) error {
+	value := query.Get(param)
+	if value == "" {
+		return nil
+	}
+	if !contains(allowed, value) {
+		return fmt.Errorf("%s %q: expected one of %s", param, value, strings.Join(allowed, ", "))
+	}
+	cfg[key] = value
+	return nil
+}
+
+// number sets the configuration key to the parameter value when it is an
+// integer between min and max
+func number(cfg ckafka.ConfigMap, query url.Values, param, key string, min, max int) error {
+	raw := query.Get(param)
+	if raw == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < min || n > max {
+		return fmt.Errorf("%s %q: expected an integer between %d and %d", param, raw, min, max)
+	}
+	cfg[key] = n
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	ckafka "github.com/confluentinc/confluent-kafka-go/kafka"
+
+	"github.com/w6d-io/hook/event"
+)
+
+// defaultProducerName is the name of the running program
+var defaultProducerName = filepath.Base(os.Args[0])
+
+// parseHeaders reads the header query parameters, formatted as name:value.
+// The value is a template executed with the payload
+//
+// Example:
+//
+//	?header=x-tenant:{{.tenant}}&header=x-source:ci
+func parseHeaders(query url.Values) ([]header, error) {
+	var headers []header
+	for _, raw := range query["header"] {
+		name, value, ok := strings.Cut(raw, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("header %q: expected name:value", raw)
+		}
+		t, err := template.New(name).Option("missingkey=error").Parse(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("header %q: %w", name, err)
+		}
+		headers = append(headers, header{name: name, value: t})
+	}
+	return headers, nil
+}
+
+// recordHeaders returns the event metadata headers followed by the headers of
+// the subscription resolved with the json message
+func (k *Kafka) recordHeaders(ctx context.Context, message []byte, now time.Time) ([]ckafka.Header, error) {
+	producer := k.producerName
+	if producer == "" {
+		producer = defaultProducerName
+	}
+	headers := []ckafka.Header{
+		{Key: HeaderContentType, Value: []byte("application/json")},
+		{Key: HeaderProducer, Value: []byte(producer)},
+		{Key: HeaderTimestamp, Value: []byte(now.UTC().Format(time.RFC3339Nano))},
+	}
+	add := func(key, value string) {
+		if value != "" {
+			headers = append(headers, ckafka.Header{Key: key, Value: []byte(value)})
+		}
+	}
+	add(HeaderEventID, event.ID(ctx))
+	add(HeaderScope, event.Scope(ctx))
+	tc := event.Trace(ctx)
+	add(HeaderTraceParent, tc.TraceParent)
+	add(HeaderTraceState, tc.TraceState)
+
+	if len(k.headers) == 0 {
+		return headers, nil
+	}
+	var data interface{}
+	_ = json.Unmarshal(message, &data)
+	for _, h := range k.headers {
+		var value strings.Builder
+		if err := h.value.Execute(&value, data); err != nil {
+			return nil, &TemplateError{Name: "header " + h.name, Err: err}
+		}
+		add(h.name, value.String())
+	}
+	return headers, nil
+}
@@ -20,10 +20,17 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net"
 	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
 
-	"github.com/avast/retry-go"
+	ckafka "github.com/confluentinc/confluent-kafka-go/kafka"
 
+	"github.com/w6d-io/hook/event"
 	"github.com/w6d-io/x/kafkax"
 	"github.com/w6d-io/x/logx"
 )
@@ -32,43 +39,42 @@ func (k *Kafka) Init(ctx context.Context, URL *url.URL) error {
 
 	log := logx.WithName(ctx, "Kafka.Init")
 
-	cfg := &kafkax.Kafka{}
-
-	passwd, ok := URL.User.Password()
 	query := URL.Query()
-
-	cfg.BootstrapServer = URL.Host
-	cfg.Username = URL.User.Username()
-	cfg.Password = passwd
-
-	var (
-		async      bool
-		protocol   = "SASL_SSL"
-		mechanisms = "PLAIN"
-	)
-	async = len(query["async"]) > 0 && query["async"][0] == "true"
-
-	if len(query["protocol"]) > 0 {
-		protocol = query["protocol"][0]
+	cfg, err := ProducerConfig(URL)
+	if err != nil {
+		log.Error(err, "parse producer config failed")
+		return err
 	}
-	if len(query["mechanisms"]) > 0 {
-		mechanisms = query["mechanisms"][0]
+	async, err := parseAsync(query)
+	if err != nil {
+		log.Error(err, "parse async failed")
+		return err
 	}
 
-	p, err := cfg.NewProducer(
-		kafkax.AuthKafka(ok),
-		kafkax.Async(async),
-		kafkax.Protocol(protocol),
-		kafkax.Mechanisms(mechanisms),
-	)
-
+	// the kafkax builder only knows the auth and async options, the client is
+	// built from the full configuration and wrapped instead
+	p, err := ckafka.NewProducer(&cfg)
 	if err != nil {
 		log.Error(err, "error while creating producer")
 		return err
 	}
 
-	k.Producer = p
+	k.Producer = &kafkax.Producer{ClientProducerAPI: p}
+	k.async = async
+	k.producerName = query.Get("producer")
 
+	if k.headers, err = parseHeaders(query); err != nil {
+		log.Error(err, "parse headers failed")
+		return err
+	}
+	if k.topic, err = parseTemplate("topicTemplate", query.Get("topicTemplate")); err != nil {
+		log.Error(err, "parse topic template failed")
+		return err
+	}
+	if k.key, err = parseTemplate("keyTemplate", query.Get("keyTemplate")); err != nil {
+		log.Error(err, "parse key template failed")
+		return err
+	}
 	return nil
 }
 
@@ -76,29 +82,50 @@ func (k *Kafka) Send(ctx context.Context, payload interface{}, URL *url.URL) err
 
 	log := logx.WithName(ctx, "Kafka.Send")
 
-	var messageKey string
-	query := URL.Query()
-	topic := query["topic"][0]
-
-	if len(query["messagekey"]) > 0 {
-		messageKey = query["messagekey"][0]
-	}
-
 	message, err := json.Marshal(payload)
 	if err != nil {
 		log.Error(err, "marshal failed")
 		return err
 	}
 
-	if err := retry.Do(
-		func() error {
-			if err := k.Producer.SetTopic(topic).Produce(messageKey, message); err != nil {
-				return err
-			}
-			return nil
-		},
-		retry.Attempts(5),
-	); err != nil {
+	query := URL.Query()
+	topic, err := render(k.topic, message, query.Get("topic"))
+	if err != nil {
+		log.Error(err, "resolve topic failed")
+		return err
+	}
+	if !topicPattern.MatchString(topic) {
+		err := &TemplateError{Name: "topic", Err: fmt.Errorf("invalid topic %q", topic)}
+		log.Error(err, "resolve topic failed")
+		return err
+	}
+	messageKey, err := render(k.key, message, query.Get("messagekey"))
+	if err != nil {
+		log.Error(err, "resolve message key failed")
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		log.Error(err, "context done")
+		return err
+	}
+	now := time.Now()
+	headers, err := k.recordHeaders(ctx, message, now)
+	if err != nil {
+		log.Error(err, "resolve headers failed")
+		return err
+	}
+	record := &ckafka.Message{
+		TopicPartition: ckafka.TopicPartition{Topic: &topic, Partition: ckafka.PartitionAny},
+		Value:          message,
+		Headers:        headers,
+		Timestamp:      now,
+	}
+	if messageKey != "" {
+		record.Key = []byte(messageKey)
+	}
+	if err := k.produce(ctx, record); err != nil {
+		log.Error(err, "produce failed")
 		return err
 	}
 	//log.V(1).Info("send payload by kafka", "payload", payload,
@@ -114,9 +141,180 @@ func (k *Kafka) Validate(URL *url.URL) error {
 		return nil
 	}
 	values := URL.Query()
-	if _, ok := values["topic"]; !ok {
+	if values.Get("topic") == "" && values.Get("topicTemplate") == "" {
 		log.Error(errors.New("missing topic"), URL.Redacted())
 		return errors.New("missing topic")
 	}
+	for _, name := range []string{"topicTemplate", "keyTemplate"} {
+		if _, err := parseTemplate(name, values.Get(name)); err != nil {
+			log.Error(err, URL.Redacted())
+			return err
+		}
+	}
+	if _, err := parseHeaders(values); err != nil {
+		log.Error(err, URL.Redacted())
+		return err
+	}
+	if _, err := ProducerConfig(URL); err != nil {
+		log.Error(err, URL.Redacted())
+		return err
+	}
 	return nil
 }
+
+// produce sends the record and waits for its delivery report unless async.
+// When async, the report comes from the producer events and is given to the
+// caller through event.Defer. A producer other than the kafkax one gets the
+// key and the value only
+func (k *Kafka) produce(ctx context.Context, record *ckafka.Message) error {
+	p, ok := k.Producer.(*kafkax.Producer)
+	if !ok {
+		return k.Producer.SetTopic(*record.TopicPartition.Topic).Produce(string(record.Key), record.Value)
+	}
+	if k.async {
+		k.reports.Do(func() { go reports(p.Events()) })
+		if ack := event.Defer(ctx); ack != nil {
+			record.Opaque = ack
+		}
+		return p.ClientProducerAPI.Produce(record, nil)
+	}
+	delivery := make(chan ckafka.Event, 1)
+	if err := p.ClientProducerAPI.Produce(record, delivery); err != nil {
+		return err
+	}
+	select {
+	case e := <-delivery:
+		if m, ok := e.(*ckafka.Message); ok && m.TopicPartition.Error != nil {
+			return m.TopicPartition.Error
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reports hands the delivery reports of the asynchronous records to the
+// function the record was produced with. It ends when the producer is closed
+func reports(events chan ckafka.Event) {
+
+	log := logx.WithName(context.TODO(), "Kafka.reports")
+
+	for e := range events {
+		m, ok := e.(*ckafka.Message)
+		if !ok {
+			continue
+		}
+		if ack, ok := m.Opaque.(func(error)); ok {
+			ack(m.TopicPartition.Error)
+			continue
+		}
+		if err := m.TopicPartition.Error; err != nil {
+			log.Error(err, "delivery failed", "partition", m.TopicPartition.String())
+		}
+	}
+}
+
+// parseTemplate parses the template of the query parameter, nil when empty
+func parseTemplate(name, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	t, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return t, nil
+}
+
+// render executes the template with the json message, or returns the value
+// when there is no template
+func render(t *template.Template, message []byte, value string) (string, error) {
+	if t == nil {
+		return value, nil
+	}
+	var data interface{}
+	_ = json.Unmarshal(message, &data)
+	var out strings.Builder
+	if err := t.Execute(&out, data); err != nil {
+		return "", &TemplateError{Name: t.Name(), Err: err}
+	}
+	return out.String(), nil
+}
+
+// Error returns the template name and the error
+func (e *TemplateError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Name, e.Err)
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable is false, the payload does not change between attempts
+func (e *TemplateError) Retryable() bool {
+	return false
+}
+
+// ParseBrokers splits the comma separated host list of a kafka URL into the
+// bootstrap servers. A broker without port gets the default one, 9092
+//
+// Example:
+//
+//	u, _ := url.Parse("kafka://b1:9092,b2,b3:9093/?topic=EVENTS")
+//	brokers, err := kafka.ParseBrokers(u.Host) // [b1:9092 b2:9092 b3:9093]
+func ParseBrokers(hosts string) ([]string, error) {
+	if hosts == "" {
+		return nil, errors.New("missing broker")
+	}
+	var brokers []string
+	seen := make(map[string]bool)
+	for _, broker := range strings.Split(hosts, ",") {
+		address := strings.TrimSpace(broker)
+		if address == "" {
+			return nil, fmt.Errorf("broker %q: missing host", broker)
+		}
+		if strings.LastIndex(address, ":") <= strings.LastIndex(address, "]") {
+			address = net.JoinHostPort(strings.Trim(address, "[]"), defaultPort)
+		}
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, fmt.Errorf("broker %q: %w", broker, err)
+		}
+		if host == "" {
+			return nil, fmt.Errorf("broker %q: missing host", broker)
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("broker %q: invalid port", broker)
+		}
+		broker = net.JoinHostPort(host, port)
+		if seen[broker] {
+			return nil, fmt.Errorf("broker %q: duplicated", broker)
+		}
+		seen[broker] = true
+		brokers = append(brokers, broker)
+	}
+	return brokers, nil
+}
+
+// Close flushes the messages still queued in the producer then closes it. The
+// flush lasts until the context deadline or 5 seconds without deadline
+func (k *Kafka) Close(ctx context.Context) error {
+
+	log := logx.WithName(ctx, "Kafka.Close")
+
+	p, ok := k.Producer.(flushCloser)
+	if !ok {
+		return nil
+	}
+	timeout := 5 * time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	var err error
+	if n := p.Flush(int(timeout.Milliseconds())); n > 0 {
+		err = fmt.Errorf("%d messages not flushed", n)
+		log.Error(err, "flush failed")
+	}
+	p.Close()
+	return err
+}
@@ -22,6 +22,8 @@ package kafka_test
 import (
 	"testing"
 
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -30,3 +32,28 @@ func TestHook(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Kafka Suite")
 }
+
+// RecordingClientProducer hands the produced messages to Messages. The
+// delivery report, failed with Err when set, goes to the delivery channel or
+// to Reports without one
+type RecordingClientProducer struct {
+	Messages chan *kafka.Message
+	Reports  chan kafka.Event
+	Err      error
+}
+
+func (r *RecordingClientProducer) Produce(msg *kafka.Message, deliveryChan chan kafka.Event) error {
+	msg.TopicPartition.Error = r.Err
+	r.Messages <- msg
+	report := deliveryChan
+	if report == nil {
+		report = r.Reports
+	}
+	if report != nil {
+		go func() { report <- msg }()
+	}
+	return nil
+}
+func (r *RecordingClientProducer) Events() chan kafka.Event { return r.Reports }
+func (r *RecordingClientProducer) Flush(int) int            { return 0 }
+func (r *RecordingClientProducer) Close()                   {}
@@ -23,15 +23,38 @@ import (
 	"context"
 	"errors"
 	"net/url"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	ckafka "github.com/confluentinc/confluent-kafka-go/kafka"
+
+	"github.com/w6d-io/hook/event"
 	"github.com/w6d-io/hook/kafka"
 	"github.com/w6d-io/x/kafkax"
 )
 
 var _ = Describe("Kafka", func() {
+	var (
+		messages chan *ckafka.Message
+		recorder *RecordingClientProducer
+	)
+	subscribe := func(rawURL string) (*kafka.Kafka, *url.URL) {
+		URL, err := url.Parse(rawURL)
+		Expect(err).To(Succeed())
+		k := &kafka.Kafka{}
+		Expect(k.Validate(URL)).To(Succeed())
+		Expect(k.Init(context.Background(), URL)).To(Succeed())
+		// replace the producer of Init by the recording one
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_ = k.Close(ctx)
+		messages = make(chan *ckafka.Message, 1)
+		recorder = &RecordingClientProducer{Messages: messages, Reports: make(chan ckafka.Event)}
+		k.Producer = &kafkax.Producer{ClientProducerAPI: recorder}
+		return k, URL
+	}
 	Context("Validate", func() {
 		BeforeEach(func() {
 		})
@@ -69,6 +92,107 @@ var _ = Describe("Kafka", func() {
 			Expect(err).To(Succeed())
 		})
 	})
+	Context("Brokers", func() {
+		It("defaults the port", func() {
+			URL, err := url.Parse("kafka://localhost?topic=TEST")
+			Expect(err).To(Succeed())
+			Expect((&kafka.Kafka{}).Validate(URL)).To(Succeed())
+			Expect(kafka.ProducerConfig(URL)).To(HaveKeyWithValue("bootstrap.servers", "localhost:9092"))
+		})
+		It("splits the host list", func() {
+			URL, err := url.Parse("kafka://b1:9092,b2:9093/?topic=TEST")
+			Expect(err).To(Succeed())
+			Expect(kafka.ParseBrokers(URL.Host)).To(Equal([]string{"b1:9092", "b2:9093"}))
+			Expect(kafka.ParseBrokers("b1:9092, [::1]:9094")).To(Equal([]string{"b1:9092", "[::1]:9094"}))
+			Expect(kafka.ParseBrokers("localhost,[::1]")).To(Equal([]string{"localhost:9092", "[::1]:9092"}))
+			Expect((&kafka.Kafka{}).Validate(URL)).To(Succeed())
+			Expect((&kafka.Kafka{}).Init(context.Background(), URL)).To(Succeed())
+		})
+		DescribeTable("rejects malformed host lists",
+			func(hosts, message string) {
+				_, err := kafka.ParseBrokers(hosts)
+				Expect(err).To(MatchError(ContainSubstring(message)))
+				URL := &url.URL{Scheme: "kafka", Host: hosts, RawQuery: "topic=TEST"}
+				Expect((&kafka.Kafka{}).Validate(URL)).ToNot(Succeed())
+				Expect((&kafka.Kafka{}).Init(context.Background(), URL)).ToNot(Succeed())
+			},
+			Entry("empty", "", "missing broker"),
+			Entry("empty broker", "b1:9092,,b2:9092", `broker "": missing host`),
+			Entry("empty port", "b1:9092,b2:", "invalid port"),
+			Entry("duplicated default port", "b1,b1:9092", "duplicated"),
+			Entry("missing host", ":9092", "missing host"),
+			Entry("invalid port", "b1:99999", "invalid port"),
+			Entry("duplicated broker", "b1:9092,b1:9092", "duplicated"),
+		)
+	})
+	Context("Producer config", func() {
+		config := func(rawURL string) ckafka.ConfigMap {
+			URL, err := url.Parse(rawURL)
+			Expect(err).To(Succeed())
+			cfg, err := kafka.ProducerConfig(URL)
+			Expect(err).To(Succeed())
+			return cfg
+		}
+		It("has no security without credentials", func() {
+			Expect(config("kafka://b1:9092,b2:9092?topic=TEST")).To(Equal(ckafka.ConfigMap{
+				"bootstrap.servers": "b1:9092,b2:9092",
+			}))
+		})
+		It("uses SASL_SSL with the credentials", func() {
+			cfg := config("kafka://user:pass@b1:9092?topic=TEST&mechanisms=SCRAM-SHA-512")
+			Expect(cfg).To(HaveKeyWithValue("security.protocol", "SASL_SSL"))
+			Expect(cfg).To(HaveKeyWithValue("sasl.mechanisms", "SCRAM-SHA-512"))
+			Expect(cfg).To(HaveKeyWithValue("sasl.username", "user"))
+			Expect(cfg).To(HaveKeyWithValue("sasl.password", "pass"))
+		})
+		It("ignores the SASL settings without credentials", func() {
+			Expect(config("kafka://b1:9092?topic=TEST&protocol=SASL_SSL&mechanisms=PLAIN")).To(Equal(ckafka.ConfigMap{
+				"bootstrap.servers": "b1:9092",
+			}))
+		})
+		It("uses SSL with the certificate files", func() {
+			cfg := config("kafka://b1:9092?topic=TEST&caFile=/ca.pem&certFile=/tls.crt&keyFile=/tls.key")
+			Expect(cfg).To(HaveKeyWithValue("security.protocol", "SSL"))
+			Expect(cfg).To(HaveKeyWithValue("ssl.ca.location", "/ca.pem"))
+			Expect(cfg).To(HaveKeyWithValue("ssl.certificate.location", "/tls.crt"))
+			Expect(cfg).To(HaveKeyWithValue("ssl.key.location", "/tls.key"))
+		})
+		It("passes the tuning", func() {
+			cfg := config("kafka://b1:9092?topic=TEST&compression=zstd&acks=all&idempotence=true" +
+				"&lingerMs=20&batchSize=65536&partitioner=murmur2_random&async=true")
+			Expect(cfg).To(HaveKeyWithValue("compression.type", "zstd"))
+			Expect(cfg).To(HaveKeyWithValue("acks", "all"))
+			Expect(cfg).To(HaveKeyWithValue("enable.idempotence", true))
+			Expect(cfg).To(HaveKeyWithValue("linger.ms", 20))
+			Expect(cfg).To(HaveKeyWithValue("batch.size", 65536))
+			Expect(cfg).To(HaveKeyWithValue("partitioner", "murmur2_random"))
+		})
+		It("accepts the consumer group id", func() {
+			URL, _ := url.Parse("kafka://b1:9092?topic=TEST&groupid=cicd")
+			Expect((&kafka.Kafka{}).Validate(URL)).To(Succeed())
+		})
+		DescribeTable("rejects bad parameters",
+			func(rawURL, message string) {
+				URL, _ := url.Parse(rawURL)
+				Expect((&kafka.Kafka{}).Validate(URL)).To(MatchError(ContainSubstring(message)))
+			},
+			Entry("unknown parameter", "kafka://b1:9092?topic=TEST&linger=5", `unknown parameter "linger"`),
+			Entry("unknown group id spelling", "kafka://b1:9092?topic=TEST&group_id=cicd", `unknown parameter "group_id"`),
+			Entry("compression", "kafka://b1:9092?topic=TEST&compression=brotli", "compression"),
+			Entry("acks", "kafka://b1:9092?topic=TEST&acks=2", "acks"),
+			Entry("idempotence", "kafka://b1:9092?topic=TEST&idempotence=yes", "idempotence"),
+			Entry("idempotence without all acks", "kafka://b1:9092?topic=TEST&idempotence=true&acks=1", "acks=all"),
+			Entry("lingerMs", "kafka://b1:9092?topic=TEST&lingerMs=-1", "lingerMs"),
+			Entry("batchSize", "kafka://b1:9092?topic=TEST&batchSize=0", "batchSize"),
+			Entry("partitioner", "kafka://b1:9092?topic=TEST&partitioner=sticky", "partitioner"),
+			Entry("async", "kafka://b1:9092?topic=TEST&async=maybe", "async"),
+			Entry("protocol", "kafka://user:pass@b1:9092?topic=TEST&protocol=TLS", "protocol"),
+			Entry("mechanism", "kafka://user:pass@b1:9092?topic=TEST&mechanisms=GSSAPI", "mechanisms"),
+			Entry("credentials without SASL", "kafka://user:pass@b1:9092?topic=TEST&protocol=SSL", "credentials"),
+			Entry("files without SSL", "kafka://b1:9092?topic=TEST&protocol=PLAINTEXT&caFile=/ca.pem", "SSL"),
+			Entry("certificate without key", "kafka://b1:9092?topic=TEST&certFile=/tls.crt", "together"),
+		)
+	})
 	Context("Send", func() {
 		It("init success", func() {
 			k := &kafka.Kafka{
@@ -123,4 +247,135 @@ var _ = Describe("Kafka", func() {
 			Expect(err).NotTo(Succeed())
 		})
 	})
+	Context("Templates", func() {
+		payload := map[string]string{"projectId": "42", "kind": "pipeline"}
+		It("resolves the topic and the key from the payload", func() {
+			k, URL := subscribe("kafka://localhost:9092?topicTemplate=" + url.QueryEscape("EVENTS_{{.kind}}") +
+				"&keyTemplate=" + url.QueryEscape("{{.projectId}}"))
+			Expect(k.Send(context.Background(), payload, URL)).To(Succeed())
+			message := <-messages
+			Expect(*message.TopicPartition.Topic).To(Equal("EVENTS_pipeline"))
+			Expect(string(message.Key)).To(Equal("42"))
+		})
+		It("prefers the templates to the literal values", func() {
+			k, URL := subscribe("kafka://localhost:9092?topic=TEST&messagekey=KEY&keyTemplate=" + url.QueryEscape("{{.projectId}}"))
+			Expect(k.Send(context.Background(), payload, URL)).To(Succeed())
+			message := <-messages
+			Expect(*message.TopicPartition.Topic).To(Equal("TEST"))
+			Expect(string(message.Key)).To(Equal("42"))
+		})
+		DescribeTable("fails without retry when the template does not apply",
+			func(query string) {
+				k, URL := subscribe("kafka://localhost:9092?topic=TEST&" + query)
+				err := k.Send(context.Background(), map[string]string{"kind": "pipe line"}, URL)
+				var templateErr *kafka.TemplateError
+				Expect(errors.As(err, &templateErr)).To(BeTrue())
+				Expect(templateErr.Retryable()).To(BeFalse())
+				Expect(messages).ToNot(Receive())
+			},
+			Entry("missing key", "keyTemplate="+url.QueryEscape("{{.projectId}}")),
+			Entry("invalid topic", "topicTemplate="+url.QueryEscape("{{.kind}}")),
+		)
+		DescribeTable("rejects bad templates",
+			func(query, message string) {
+				URL, _ := url.Parse("kafka://localhost:9092?" + query)
+				Expect((&kafka.Kafka{}).Validate(URL)).To(MatchError(ContainSubstring(message)))
+			},
+			Entry("without topic", "keyTemplate=x", "missing topic"),
+			Entry("bad topic template", "topicTemplate="+url.QueryEscape("{{.kind"), "topicTemplate"),
+			Entry("bad key template", "topic=TEST&keyTemplate="+url.QueryEscape("{{.id"), "keyTemplate"),
+		)
+	})
+	Context("Headers", func() {
+		header := func(message *ckafka.Message, key string) string {
+			for _, h := range message.Headers {
+				if h.Key == key {
+					return string(h.Value)
+				}
+			}
+			return ""
+		}
+		It("sets the event metadata", func() {
+			k, URL := subscribe("kafka://localhost:9092?topic=TEST&producer=ci")
+			ctx := event.WithID(context.Background(), "evt-1")
+			ctx = event.WithScope(ctx, "project")
+			ctx = event.WithTraceContext(ctx, event.TraceContext{
+				TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+				TraceState:  "vendor=1",
+			})
+			Expect(k.Send(ctx, map[string]string{"kind": "pipeline"}, URL)).To(Succeed())
+			message := <-messages
+			Expect(header(message, kafka.HeaderEventID)).To(Equal("evt-1"))
+			Expect(header(message, kafka.HeaderScope)).To(Equal("project"))
+			Expect(header(message, kafka.HeaderContentType)).To(Equal("application/json"))
+			Expect(header(message, kafka.HeaderProducer)).To(Equal("ci"))
+			Expect(header(message, kafka.HeaderTraceParent)).To(HavePrefix("00-4bf92f"))
+			Expect(header(message, kafka.HeaderTraceState)).To(Equal("vendor=1"))
+			sent, err := time.Parse(time.RFC3339Nano, header(message, kafka.HeaderTimestamp))
+			Expect(err).To(Succeed())
+			Expect(sent).To(BeTemporally("~", time.Now(), time.Minute))
+		})
+		It("omits the unknown event metadata", func() {
+			k, URL := subscribe("kafka://localhost:9092?topic=TEST")
+			Expect(k.Send(context.Background(), map[string]string{}, URL)).To(Succeed())
+			message := <-messages
+			Expect(header(message, kafka.HeaderEventID)).To(BeEmpty())
+			Expect(header(message, kafka.HeaderTraceParent)).To(BeEmpty())
+			Expect(header(message, kafka.HeaderProducer)).ToNot(BeEmpty())
+		})
+		It("adds the static and templated headers", func() {
+			k, URL := subscribe("kafka://localhost:9092?topic=TEST&header=x-source:ci&header=" +
+				url.QueryEscape("x-kind:{{.kind}}"))
+			Expect(k.Send(context.Background(), map[string]string{"kind": "pipeline"}, URL)).To(Succeed())
+			message := <-messages
+			Expect(header(message, "x-source")).To(Equal("ci"))
+			Expect(header(message, "x-kind")).To(Equal("pipeline"))
+		})
+		It("fails without retry when the header template does not apply", func() {
+			k, URL := subscribe("kafka://localhost:9092?topic=TEST&header=" + url.QueryEscape("x-kind:{{.kind}}"))
+			err := k.Send(context.Background(), map[string]string{}, URL)
+			var templateErr *kafka.TemplateError
+			Expect(errors.As(err, &templateErr)).To(BeTrue())
+			Expect(templateErr.Retryable()).To(BeFalse())
+		})
+		DescribeTable("rejects bad headers",
+			func(value string) {
+				URL, _ := url.Parse("kafka://localhost:9092?topic=TEST&header=" + url.QueryEscape(value))
+				Expect((&kafka.Kafka{}).Validate(URL)).To(MatchError(ContainSubstring("header")))
+			},
+			Entry("without value", "x-source"),
+			Entry("without name", ":ci"),
+			Entry("bad template", "x-kind:{{.kind"),
+		)
+	})
+	Context("Delivery reports", func() {
+		It("fails with the delivery report", func() {
+			k, URL := subscribe("kafka://localhost:9092?topic=TEST")
+			recorder.Err = ckafka.NewError(ckafka.ErrMsgTimedOut, "timed out", false)
+			Expect(k.Send(context.Background(), "message", URL)).To(MatchError(ContainSubstring("timed out")))
+		})
+		It("defers the outcome when async", func() {
+			k, URL := subscribe("kafka://localhost:9092?topic=TEST&async=true")
+			recorder.Err = ckafka.NewError(ckafka.ErrMsgTimedOut, "timed out", false)
+			ctx, pending := event.WithPending(context.Background())
+			Expect(k.Send(ctx, "message", URL)).To(Succeed())
+			Expect(pending.Deferred()).To(BeTrue())
+			Expect(pending.Wait(context.Background())).To(MatchError(ContainSubstring("timed out")))
+		})
+		It("does not defer when the caller does not wait", func() {
+			k, URL := subscribe("kafka://localhost:9092?topic=TEST&async=true")
+			Expect(k.Send(context.Background(), "message", URL)).To(Succeed())
+			Expect(messages).To(Receive())
+		})
+	})
+	Context("Close", func() {
+		It("flushes and closes the producer", func() {
+			k := &kafka.Kafka{
+				Producer: &kafkax.Producer{
+					ClientProducerAPI: &kafkax.MockClientProducer{},
+				},
+			}
+			Expect(k.Close(context.Background())).To(Succeed())
+		})
+	})
 })
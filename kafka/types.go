@@ -17,9 +17,80 @@ Created on 16/02/2021
 package kafka
 
 import (
+	"regexp"
+	"sync"
+	"text/template"
+
 	"github.com/w6d-io/x/kafkax"
 )
 
 type Kafka struct {
 	Producer kafkax.ProducerAPI
+
+	// topic and key are executed with the payload when set, they take
+	// precedence over the topic and messagekey query parameters
+	topic *template.Template
+	key   *template.Template
+	// async does not wait for the delivery report, it comes from the
+	// producer events read by one goroutine started on the first record
+	async   bool
+	reports sync.Once
+	// producerName is sent in the producer header
+	producerName string
+	// headers are added to every record, their value is a template executed
+	// with the payload
+	headers []header
+}
+
+type header struct {
+	name  string
+	value *template.Template
+}
+
+// The record headers set on every message, the event ones when known
+const (
+	HeaderEventID     = "event-id"
+	HeaderScope       = "event-scope"
+	HeaderTimestamp   = "event-time"
+	HeaderContentType = "content-type"
+	HeaderProducer    = "producer"
+	HeaderTraceParent = "traceparent"
+	HeaderTraceState  = "tracestate"
+)
+
+// params are the query parameters of a kafka subscription
+var params = []string{"topic", "topicTemplate", "messagekey", "keyTemplate", "header", "producer",
+	"async", "protocol", "mechanisms", "compression", "acks", "idempotence", "lingerMs", "batchSize",
+	"partitioner", "caFile", "certFile", "keyFile"}
+
+// consumerParams are accepted for the URLs shared with a consumer, but not
+// used by the producer
+var consumerParams = []string{"groupid"}
+
+// The values supported by the producer parameters
+var (
+	protocols    = []string{"PLAINTEXT", "SSL", "SASL_PLAINTEXT", "SASL_SSL"}
+	mechanisms   = []string{"PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512"}
+	compressions = []string{"none", "gzip", "snappy", "lz4", "zstd"}
+	acks         = []string{"0", "1", "all", "-1"}
+	partitioners = []string{"random", "consistent", "consistent_random", "murmur2", "murmur2_random",
+		"fnv1a", "fnv1a_random"}
+)
+
+// defaultPort is the port of the brokers given without one
+const defaultPort = "9092"
+
+// topicPattern matches the legal topic names
+var topicPattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,249}$`)
+
+// TemplateError is returned when the topic or key template does not apply to
+// the payload. Sending it again would fail the same way
+type TemplateError struct {
+	Name string
+	Err  error
+}
+
+type flushCloser interface {
+	Flush(timeoutMs int) int
+	Close()
 }
@@ -0,0 +1,447 @@
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package hook
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/w6d-io/hook/event"
+
+	"github.com/w6d-io/x/logx"
+)
+
+// Outbox is an append-only log of the payloads given to Send. A payload is
+// written before being dispatched and marked as done once every subscriber in
+// scope received it, so the undelivered ones are replayed after a restart.
+// Each attempt records the subscriptions served, a replay only targets the
+// others
+type Outbox struct {
+	mu        sync.Mutex
+	path      string
+	file      *os.File
+	pending   map[string]outboxRecord
+	inflight  map[string]struct{}
+	closed    bool
+	abandoned uint64
+}
+
+// outboxRecord is a line of the log. The first one of an entry holds the
+// payload, the next ones its attempts until it is done
+type outboxRecord struct {
+	ID      string          `json:"id"`
+	Scope   string          `json:"scope,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Created time.Time       `json:"created,omitempty"`
+	Done    bool            `json:"done,omitempty"`
+	// Attempts is the number of deliveries of the entry so far
+	Attempts int `json:"attempts,omitempty"`
+	// Expected are the keys of the subscriptions in scope on Send, the entry
+	// is done once they are all settled
+	Expected []string `json:"expected,omitempty"`
+	// Settled are the keys of the subscriptions served by the entry
+	Settled []string `json:"settled,omitempty"`
+}
+
+// targets tells whether the replay of the entry goes to the subscription
+func (r outboxRecord) targets(key string) bool {
+	if contains(r.Settled, key) {
+		return false
+	}
+	return len(r.Expected) == 0 || contains(r.Expected, key)
+}
+
+// complete tells whether all the expected subscriptions are settled
+func (r outboxRecord) complete() bool {
+	for _, key := range r.Expected {
+		if !contains(r.Settled, key) {
+			return false
+		}
+	}
+	return true
+}
+
+// DefaultReplayLimit is the number of attempts after which an outbox entry is
+// given up
+const DefaultReplayLimit = 10
+
+// ErrOutboxClosed is returned when writing to a closed Outbox
+var ErrOutboxClosed = errors.New("outbox is closed")
+
+// OpenOutbox opens or creates the outbox log at path. The entries not marked
+// as done are kept as pending, the log is compacted to hold only them
+func OpenOutbox(path string) (*Outbox, error) {
+	log := logx.WithName(context.TODO(), "Outbox.Open").WithValues("path", path)
+
+	o := &Outbox{
+		path:     path,
+		pending:  make(map[string]outboxRecord),
+		inflight: make(map[string]struct{}),
+	}
+	var order []string
+	f, err := os.Open(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		log.Error(err, "open failed")
+		return nil, err
+	default:
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+		for scanner.Scan() {
+			var r outboxRecord
+			if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+				// a torn line left by a crash while writing
+				log.Error(err, "skip corrupted record")
+				continue
+			}
+			if r.Done {
+				delete(o.pending, r.ID)
+				continue
+			}
+			if entry, ok := o.pending[r.ID]; ok && r.Payload == nil {
+				entry.Attempts = r.Attempts
+				entry.Settled = append(entry.Settled, r.Settled...)
+				o.pending[r.ID] = entry
+				continue
+			}
+			o.pending[r.ID] = r
+			order = append(order, r.ID)
+		}
+		err = scanner.Err()
+		_ = f.Close()
+		if err != nil {
+			log.Error(err, "read failed")
+			return nil, err
+		}
+	}
+
+	// compact into a new file then swap it
+	tmp := path + ".tmp"
+	f, err = os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		log.Error(err, "create failed")
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	for _, id := range order {
+		r, ok := o.pending[id]
+		if !ok {
+			continue
+		}
+		if err := writeRecord(w, r); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		log.Error(err, "rename failed")
+		return nil, err
+	}
+	if d, err := os.Open(filepath.Dir(path)); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+
+	o.file, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		log.Error(err, "open for append failed")
+		return nil, err
+	}
+	return o, nil
+}
+
+// Len returns the number of entries not delivered yet
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.pending)
+}
+
+// Abandoned returns the number of entries given up after too many attempts
+func (o *Outbox) Abandoned() uint64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.abandoned
+}
+
+// Close closes the log, the pending entries stay in it
+func (o *Outbox) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return nil
+	}
+	o.closed = true
+	return o.file.Close()
+}
+
+// add writes the payload in the log and marks it in flight. expected are the
+// keys of the subscriptions to deliver
+func (o *Outbox) add(scope string, payload interface{}, expected []string) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	r := outboxRecord{
+		ID:       uuid.New().String(),
+		Scope:    scope,
+		Payload:  data,
+		Created:  time.Now().UTC(),
+		Expected: expected,
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return "", ErrOutboxClosed
+	}
+	if err := o.append(r); err != nil {
+		return "", err
+	}
+	o.pending[r.ID] = r
+	o.inflight[r.ID] = struct{}{}
+	return r.ID, nil
+}
+
+// release gives the entry back to the replays without counting an attempt
+func (o *Outbox) release(id string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.inflight, id)
+}
+
+// done records an attempt of the entry and the subscriptions it settled. The
+// entry is marked as delivered when ok is true and all its expected
+// subscriptions are settled. It is given up once it reaches limit attempts,
+// unless limit is 0, and returned then
+func (o *Outbox) done(id string, settled []string, ok bool, limit int) (*outboxRecord, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.inflight, id)
+	if o.closed {
+		return nil, nil
+	}
+	r, found := o.pending[id]
+	if !found {
+		return nil, nil
+	}
+	r.Attempts++
+	r.Settled = append(r.Settled, settled...)
+	ok = ok && r.complete()
+	var abandoned *outboxRecord
+	if !ok {
+		if limit == 0 || r.Attempts < limit {
+			o.pending[id] = r
+			return nil, o.append(outboxRecord{ID: id, Attempts: r.Attempts, Settled: settled})
+		}
+		o.abandoned++
+		abandoned = &r
+	}
+	delete(o.pending, id)
+	if len(o.pending) == 0 {
+		// nothing left to replay, start over with an empty log
+		if err := o.file.Truncate(0); err != nil {
+			return abandoned, err
+		}
+		return abandoned, o.file.Sync()
+	}
+	return abandoned, o.append(outboxRecord{ID: id, Done: true})
+}
+
+// claim returns the pending entries not in flight and marks them in flight
+func (o *Outbox) claim() []outboxRecord {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var records []outboxRecord
+	for id, r := range o.pending {
+		if _, ok := o.inflight[id]; ok {
+			continue
+		}
+		o.inflight[id] = struct{}{}
+		records = append(records, r)
+	}
+	return records
+}
+
+// append writes the record and syncs the log, the caller holds the lock
+func (o *Outbox) append(r outboxRecord) error {
+	w := bufio.NewWriter(o.file)
+	if err := writeRecord(w, r); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return o.file.Sync()
+}
+
+// subscriptionKey identifies the subscription by its URL, unlike its id it
+// stays the same after a restart, also when subscribed again with another
+// scope. It is hashed to keep the credentials out of the log
+func subscriptionKey(URLRaw string) string {
+	sum := sha256.Sum256([]byte(URLRaw))
+	return hex.EncodeToString(sum[:8])
+}
+
+func writeRecord(w *bufio.Writer, r outboxRecord) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return nil
+}
+
+// WithOutbox writes every payload given to Send in the outbox before
+// dispatching it. The entries not delivered to all their subscribers are
+// replayed every interval, and on Replay
+func WithOutbox(o *Outbox, interval time.Duration) Option {
+	return func(h *Hook) {
+		h.outbox = o
+		h.replayInterval = interval
+	}
+}
+
+// WithReplayLimit sets the number of attempts after which an outbox entry is
+// given up, DefaultReplayLimit by default. 0 replays the entries forever
+func WithReplayLimit(attempts int) Option {
+	return func(h *Hook) {
+		h.replayLimit = attempts
+	}
+}
+
+// settle records the attempt of the outbox entry. The failed deliveries of an
+// entry given up become dead letters
+func (h *Hook) settle(ctx context.Context, id string, report *DeliveryReport, settled []string) {
+	log := logx.WithName(ctx, "Hook.settle").WithValues("id", id)
+	abandoned, err := h.outbox.done(id, settled, report.handled(), h.replayLimit)
+	if err != nil {
+		log.Error(err, "mark outbox entry as done failed")
+	}
+	if abandoned != nil {
+		h.abandon(ctx, *abandoned, report)
+	}
+}
+
+// abandon keeps the outbox entry given up as dead letters, one per failed
+// delivery, or a single one without subscription when the expected ones were
+// not recorded again. They are not sent to a dead-letter target, the failed
+// subscriptions having none
+func (h *Hook) abandon(ctx context.Context, r outboxRecord, report *DeliveryReport) {
+	log := logx.WithName(ctx, "Hook.abandon").WithValues("id", r.ID)
+	letter := DeadLetter{
+		EventID:        r.ID,
+		Scope:          r.Scope,
+		Payload:        r.Payload,
+		FirstAttemptAt: r.Created,
+		FailedAt:       time.Now().UTC(),
+	}
+	failed := report.Failed()
+	if len(failed) == 0 {
+		failed = []Delivery{{Err: errors.New("subscriptions not recorded")}}
+	}
+	for _, d := range failed {
+		if d.DeadLetterID != "" {
+			continue
+		}
+		letter.ID = uuid.New().String()
+		letter.SubscriptionID, letter.URL = d.SubscriptionID, d.URL
+		letter.Error = fmt.Sprintf("outbox entry given up after %d attempts: %v", r.Attempts, d.Err)
+		letter.Attempts = d.Attempts
+		h.keepDeadLetter(ctx, letter)
+		log.Error(d.Err, "outbox entry given up", "attempts", r.Attempts, "deadLetter", letter.ID)
+	}
+}
+
+// Replay sends again the outbox entries that are not delivered yet and not
+// being sent, to the subscriptions in scope on Send they did not serve yet.
+// It does nothing while there is no subscriber, so entries left by a previous
+// run wait for the subscriptions to be recorded. An entry is kept until all
+// its subscriptions are served or the replay limit is reached
+func (h *Hook) Replay(ctx context.Context) error {
+	log := logx.WithName(ctx, "Hook.Replay")
+	if h.outbox == nil {
+		return nil
+	}
+	h.mu.RLock()
+	n := len(h.subscribers)
+	h.mu.RUnlock()
+	if n == 0 {
+		return nil
+	}
+	var errs []error
+	records := h.outbox.claim()
+	for i, r := range records {
+		if err := h.acquire(); err != nil {
+			for _, left := range records[i:] {
+				h.outbox.release(left.ID)
+			}
+			return err
+		}
+		report, settled := h.deliver(event.WithID(ctx, r.ID), r.Payload, r.Scope, r.targets)
+		err := report.Err()
+		h.settle(ctx, r.ID, report, settled)
+		h.release()
+		if err != nil {
+			log.Error(err, "replay failed", "id", r.ID)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// replayLoop calls Replay every interval until the Hook is closed
+func (h *Hook) replayLoop() {
+	ticker := time.NewTicker(h.replayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+			ctx, cancel := h.detach(context.Background())
+			_ = h.Replay(ctx)
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,184 @@
+//go:build !integration
+
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package hook_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/w6d-io/hook"
+)
+
+var _ = Describe("Outbox", func() {
+	var (
+		ctx  context.Context
+		path string
+	)
+	BeforeEach(func() {
+		ctx = context.Background()
+		path = filepath.Join(GinkgoT().TempDir(), "outbox.log")
+	})
+	It("removes the delivered entries", func() {
+		o, err := hook.OpenOutbox(path)
+		Expect(err).To(Succeed())
+		h := hook.New(hook.WithProvider("http", NewTestAllOk), hook.WithOutbox(o, 0))
+		Expect(h.Subscribe(ctx, "http://localhost", "*")).ToNot(BeEmpty())
+		Expect(h.Send(ctx, map[string]string{"id": "1"}, "test")).To(Succeed())
+		Expect(h.Close(ctx)).To(Succeed())
+		Expect(o.Len()).To(Equal(0))
+		info, err := os.Stat(path)
+		Expect(err).To(Succeed())
+		Expect(info.Size()).To(BeZero())
+	})
+	It("replays the undelivered entries after a restart", func() {
+		o, err := hook.OpenOutbox(path)
+		Expect(err).To(Succeed())
+		h := hook.New(hook.WithProvider("http", NewTestSendFail), hook.WithOutbox(o, 0))
+		Expect(h.Subscribe(ctx, "http://localhost/{{.id}}", "*")).ToNot(BeEmpty())
+		Expect(h.Send(ctx, map[string]string{"id": "1"}, "test")).To(Succeed())
+		Expect(h.Close(ctx)).To(Succeed())
+		Expect(o.Len()).To(Equal(1))
+
+		By("opening the outbox again")
+		o, err = hook.OpenOutbox(path)
+		Expect(err).To(Succeed())
+		Expect(o.Len()).To(Equal(1))
+		sent := make(chan string, 1)
+		h = hook.New(hook.WithProvider("http", func() hook.Interface {
+			return &TestRecorder{Sent: sent}
+		}), hook.WithOutbox(o, 10*time.Millisecond))
+		Expect(h.Subscribe(ctx, "http://localhost/{{.id}}", "test")).ToNot(BeEmpty())
+		Eventually(sent).Should(Receive(Equal("localhost")))
+		Eventually(o.Len).Should(BeZero())
+		Expect(h.Close(ctx)).To(Succeed())
+	})
+	It("replays only to the subscriptions not served", func() {
+		sent := make(chan string, 2)
+		recorder := func() hook.Interface { return &TestRecorder{Sent: sent} }
+		o, err := hook.OpenOutbox(path)
+		Expect(err).To(Succeed())
+		h := hook.New(hook.WithProvider("ok", recorder), hook.WithProvider("fail", NewTestSendFail), hook.WithOutbox(o, 0))
+		Expect(h.Subscribe(ctx, "ok://a", "*")).ToNot(BeEmpty())
+		Expect(h.Subscribe(ctx, "fail://b?retries=0", "*")).ToNot(BeEmpty())
+		Expect(h.Send(ctx, "message", "test")).To(Succeed())
+		Expect(h.Close(ctx)).To(Succeed())
+		Expect(sent).To(Receive(Equal("a")))
+		Expect(o.Len()).To(Equal(1))
+
+		By("replaying after a restart")
+		o, err = hook.OpenOutbox(path)
+		Expect(err).To(Succeed())
+		h = hook.New(hook.WithProvider("ok", recorder), hook.WithProvider("fail", recorder), hook.WithOutbox(o, 0))
+		Expect(h.Subscribe(ctx, "ok://a", "*")).ToNot(BeEmpty())
+		Expect(h.Subscribe(ctx, "fail://b?retries=0", "*")).ToNot(BeEmpty())
+		Expect(h.Replay(ctx)).To(Succeed())
+		Expect(sent).To(Receive(Equal("b")))
+		Expect(sent).ToNot(Receive())
+		Expect(o.Len()).To(BeZero())
+		Expect(h.Close(ctx)).To(Succeed())
+	})
+	It("gives up an entry after the replay limit", func() {
+		o, err := hook.OpenOutbox(path)
+		Expect(err).To(Succeed())
+		h := hook.New(hook.WithProvider("http", NewTestSendFail), hook.WithOutbox(o, 0))
+		Expect(h.Subscribe(ctx, "http://localhost?retries=0", "*")).ToNot(BeEmpty())
+		Expect(h.Send(ctx, "message", "test")).To(Succeed())
+		Expect(h.Close(ctx)).To(Succeed())
+		Expect(o.Len()).To(Equal(1))
+
+		By("counting the attempt of the previous run")
+		o, err = hook.OpenOutbox(path)
+		Expect(err).To(Succeed())
+		h = hook.New(hook.WithProvider("http", NewTestSendFail), hook.WithOutbox(o, 0), hook.WithReplayLimit(2))
+		Expect(h.Subscribe(ctx, "http://localhost?retries=0", "*")).ToNot(BeEmpty())
+		Expect(h.Replay(ctx)).ToNot(Succeed())
+		Expect(o.Len()).To(BeZero())
+		Expect(o.Abandoned()).To(Equal(uint64(1)))
+		Expect(h.DeadLetters()).To(HaveLen(1))
+		Expect(h.Replay(ctx)).To(Succeed())
+		Expect(h.Close(ctx)).To(Succeed())
+	})
+	It("keeps the entry until every subscription got it", func() {
+		o, err := hook.OpenOutbox(path)
+		Expect(err).To(Succeed())
+		h := hook.New(hook.WithProvider("ok", NewTestSendFail), hook.WithProvider("fail", NewTestSendFail), hook.WithOutbox(o, 0))
+		Expect(h.Subscribe(ctx, "ok://a?retries=0", "*")).ToNot(BeEmpty())
+		Expect(h.Subscribe(ctx, "fail://b?retries=0", "*")).ToNot(BeEmpty())
+		Expect(h.Send(ctx, "message", "test")).To(Succeed())
+		Expect(h.Close(ctx)).To(Succeed())
+		Expect(o.Len()).To(Equal(1))
+
+		By("replaying while only the first subscription is back")
+		sent := make(chan string, 2)
+		recorder := func() hook.Interface { return &TestRecorder{Sent: sent} }
+		o, err = hook.OpenOutbox(path)
+		Expect(err).To(Succeed())
+		h = hook.New(hook.WithProvider("ok", recorder), hook.WithProvider("fail", recorder), hook.WithOutbox(o, 0))
+		Expect(h.Subscribe(ctx, "ok://a?retries=0", "*")).ToNot(BeEmpty())
+		Expect(h.Replay(ctx)).To(Succeed())
+		Expect(sent).To(Receive(Equal("a")))
+		Expect(o.Len()).To(Equal(1))
+
+		By("replaying once the second one is back")
+		Expect(h.Subscribe(ctx, "fail://b?retries=0", "*")).ToNot(BeEmpty())
+		Expect(h.Replay(ctx)).To(Succeed())
+		Expect(sent).To(Receive(Equal("b")))
+		Expect(sent).ToNot(Receive())
+		Expect(o.Len()).To(BeZero())
+		Expect(h.Close(ctx)).To(Succeed())
+	})
+	It("dead letters the entry given up to be redriven", func() {
+		var fail atomic.Bool
+		fail.Store(true)
+		o, err := hook.OpenOutbox(path)
+		Expect(err).To(Succeed())
+		h := hook.New(hook.WithProvider("http", func() hook.Interface { return &TestToggle{Fail: &fail} }),
+			hook.WithOutbox(o, 0), hook.WithReplayLimit(1))
+		id, err := h.Subscribe(ctx, "http://localhost?retries=0", "*")
+		Expect(err).To(Succeed())
+		Expect(h.Send(ctx, "message", "test")).To(Succeed())
+		Eventually(h.DeadLetters).Should(HaveLen(1))
+		letter := h.DeadLetters()[0]
+		Expect(letter.SubscriptionID).To(Equal(id))
+		Expect(string(letter.Payload)).To(Equal(`"message"`))
+		Expect(letter.Error).To(ContainSubstring("given up after 1 attempts"))
+		Expect(o.Len()).To(BeZero())
+		Expect(o.Abandoned()).To(Equal(uint64(1)))
+
+		fail.Store(false)
+		_, err = h.Redrive(ctx, letter.ID)
+		Expect(err).To(Succeed())
+		Expect(h.DeadLetters()).To(BeEmpty())
+		Expect(h.Close(ctx)).To(Succeed())
+	})
+	It("skips a corrupted record", func() {
+		Expect(os.WriteFile(path, []byte(`{"id":"1","scope":"test","payload":"message"}`+"\n"+`{"id":"2","sco`), 0o600)).To(Succeed())
+		o, err := hook.OpenOutbox(path)
+		Expect(err).To(Succeed())
+		Expect(o.Len()).To(Equal(1))
+		Expect(o.Close()).To(Succeed())
+	})
+})
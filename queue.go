@@ -0,0 +1,175 @@
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package hook
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/w6d-io/x/logx"
+)
+
+// OverflowPolicy tells what Send does when the queue is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits for room in the queue or the caller context to be done
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest queued payload to make room
+	OverflowDropOldest
+	// OverflowDropNewest drops the payload given to Send
+	OverflowDropNewest
+	// OverflowError returns ErrQueueFull
+	OverflowError
+)
+
+// job is a payload given to Send waiting for a worker
+type job struct {
+	ctx     context.Context
+	payload interface{}
+	scope   string
+	// entry is the id of the payload in the outbox
+	entry string
+}
+
+// QueueStats are the metrics of the Send queue
+type QueueStats struct {
+	// Depth is the number of payloads waiting for a worker
+	Depth    int
+	Capacity int
+	Workers  int
+	// Pending is the number of sends queued or being delivered
+	Pending int64
+	// Dropped is the number of payloads dropped by the overflow policy
+	Dropped uint64
+}
+
+// WithQueue bounds the asynchronous Send to a queue of size payloads handled
+// by workers goroutines. The policy tells what to do when the queue is full.
+// Without queue each Send runs in its own goroutine
+func WithQueue(size, workers int, policy OverflowPolicy) Option {
+	return func(h *Hook) {
+		if workers < 1 {
+			workers = 1
+		}
+		h.queue = make(chan job, size)
+		h.workers = workers
+		h.overflow = policy
+	}
+}
+
+// Stats returns the metrics of the Send queue
+func (h *Hook) Stats() QueueStats {
+	return QueueStats{
+		Depth:    len(h.queue),
+		Capacity: cap(h.queue),
+		Workers:  h.workers,
+		Pending:  atomic.LoadInt64(&h.pending),
+		Dropped:  atomic.LoadUint64(&h.dropped),
+	}
+}
+
+// enqueue hands the job to the workers according to the overflow policy
+func (h *Hook) enqueue(ctx context.Context, j job) (err error) {
+	defer func() {
+		if err == nil && h.lifetime.Err() != nil {
+			// queued after the workers stopped
+			h.drain()
+		}
+	}()
+	select {
+	case h.queue <- j:
+		return nil
+	default:
+	}
+	switch h.overflow {
+	case OverflowDropNewest:
+		h.drop(j)
+		return nil
+	case OverflowError:
+		h.discard(j)
+		return ErrQueueFull
+	case OverflowDropOldest:
+		for {
+			select {
+			case h.queue <- j:
+				return nil
+			default:
+			}
+			select {
+			case old := <-h.queue:
+				h.drop(old)
+			default:
+			}
+		}
+	default:
+		select {
+		case h.queue <- j:
+			return nil
+		case <-ctx.Done():
+			h.discard(j)
+			return ctx.Err()
+		case <-h.lifetime.Done():
+			h.discard(j)
+			return ErrClosed
+		}
+	}
+}
+
+// drop counts the job as dropped by the overflow policy
+func (h *Hook) drop(j job) {
+	log := logx.WithName(j.ctx, "Hook.Send")
+	atomic.AddUint64(&h.dropped, 1)
+	log.Error(ErrQueueFull, "payload dropped", "scope", j.scope)
+	h.discard(j)
+}
+
+// discard releases a job that will not be delivered. Its outbox entry stays
+// pending to be replayed
+func (h *Hook) discard(j job) {
+	if h.outbox != nil {
+		h.outbox.release(j.entry)
+	}
+	h.release()
+}
+
+// work runs the queued jobs until the Hook is closed, then discards the jobs
+// left in the queue
+func (h *Hook) work() {
+	for {
+		select {
+		case <-h.lifetime.Done():
+			h.drain()
+			return
+		case j := <-h.queue:
+			h.run(j)
+		}
+	}
+}
+
+// drain discards the queued jobs without waiting
+func (h *Hook) drain() {
+	for {
+		select {
+		case j := <-h.queue:
+			h.discard(j)
+		default:
+			return
+		}
+	}
+}
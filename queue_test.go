@@ -0,0 +1,111 @@
+//go:build !integration
+
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package hook_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/w6d-io/hook"
+)
+
+var _ = Describe("Queue", func() {
+	var (
+		ctx      context.Context
+		payloads chan interface{}
+		release  chan struct{}
+		h        *hook.Hook
+	)
+	// newHook returns a Hook with a queue of one payload and one worker busy
+	// with the "first" payload
+	newHook := func(policy hook.OverflowPolicy) *hook.Hook {
+		h := hook.New(
+			hook.WithProvider("http", func() hook.Interface {
+				return &TestPayloads{Payloads: payloads, Release: release}
+			}),
+			hook.WithQueue(1, 1, policy),
+		)
+		Expect(h.Subscribe(ctx, "http://localhost", "*")).ToNot(BeEmpty())
+		Expect(h.Send(ctx, "first", "test")).To(Succeed())
+		Eventually(payloads).Should(Receive(Equal("first")))
+		Expect(h.Send(ctx, "second", "test")).To(Succeed())
+		return h
+	}
+	BeforeEach(func() {
+		ctx = context.Background()
+		payloads = make(chan interface{}, 10)
+		release = make(chan struct{})
+	})
+	AfterEach(func() {
+		close(release)
+		Expect(h.Close(ctx)).To(Succeed())
+	})
+	It("blocks until the caller context is done", func() {
+		h = newHook(hook.OverflowBlock)
+		c, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		Expect(h.Send(c, "third", "test")).To(MatchError(context.DeadlineExceeded))
+		Expect(h.Stats()).To(Equal(hook.QueueStats{Depth: 1, Capacity: 1, Workers: 1, Pending: 2}))
+	})
+	It("returns an error", func() {
+		h = newHook(hook.OverflowError)
+		Expect(h.Send(ctx, "third", "test")).To(MatchError(hook.ErrQueueFull))
+	})
+	It("drops the newest payload", func() {
+		h = newHook(hook.OverflowDropNewest)
+		Expect(h.Send(ctx, "third", "test")).To(Succeed())
+		Expect(h.Stats().Dropped).To(Equal(uint64(1)))
+		release <- struct{}{}
+		Eventually(payloads).Should(Receive(Equal("second")))
+	})
+	It("drops the oldest payload", func() {
+		h = newHook(hook.OverflowDropOldest)
+		Expect(h.Send(ctx, "third", "test")).To(Succeed())
+		Expect(h.Stats().Dropped).To(Equal(uint64(1)))
+		release <- struct{}{}
+		Eventually(payloads).Should(Receive(Equal("third")))
+	})
+	It("discards the queued payloads when Close is cancelled", func() {
+		sender := &TestBlocking{Release: make(chan struct{}), Closed: make(chan struct{})}
+		defer close(sender.Release)
+		h = hook.New(
+			hook.WithProvider("http", func() hook.Interface { return sender }),
+			hook.WithQueue(20, 1, hook.OverflowBlock),
+		)
+		Expect(h.Subscribe(ctx, "http://localhost", "*")).ToNot(BeEmpty())
+		for i := 0; i < 20; i++ {
+			Expect(h.Send(ctx, i, "test")).To(Succeed())
+		}
+		Eventually(sender.Sending.Load).Should(Equal(int32(1)))
+		c, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err := h.Close(c)
+		Expect(err).To(MatchError(hook.ErrDropped))
+		Expect(err).ToNot(MatchError(ContainSubstring("left open")))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		Expect(sender.Closed).To(BeClosed())
+		Expect(h.Stats().Pending).To(BeZero())
+		h = hook.New()
+	})
+})
@@ -0,0 +1,361 @@
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+// Package receiver verifies and decodes the webhooks sent by the Hook http
+// provider, sharing the signature implementation with it
+package receiver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/w6d-io/hook/signature"
+
+	"github.com/w6d-io/x/logx"
+)
+
+// New returns a Receiver verifying the signature scheme, standard or github,
+// with the secrets. Several secrets are accepted while rotating them
+func New(scheme string, secrets []string, opts ...Option) (*Receiver, error) {
+	if !signature.Supported(scheme) {
+		return nil, fmt.Errorf("signature %q not supported", scheme)
+	}
+	if len(secrets) == 0 {
+		return nil, errors.New("no secret")
+	}
+	r := &Receiver{
+		scheme:      scheme,
+		tolerance:   DefaultTolerance,
+		maxBodySize: DefaultMaxBodySize,
+		replays:     &memoryStore{ids: make(map[string]replayState)},
+	}
+	for _, secret := range secrets {
+		key, err := signature.Secret(secret)
+		if err != nil {
+			return nil, err
+		}
+		r.keys = append(r.keys, key)
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r, nil
+}
+
+// WithTolerance sets the maximum gap between the webhook timestamp and now
+func WithTolerance(d time.Duration) Option {
+	return func(r *Receiver) {
+		r.tolerance = d
+	}
+}
+
+// WithMaxBodySize sets the maximum size of the body read
+func WithMaxBodySize(n int64) Option {
+	return func(r *Receiver) {
+		r.maxBodySize = n
+	}
+}
+
+// WithReplayStore sets the store of the webhook ids already received, to share
+// them between several instances
+func WithReplayStore(s ReplayStore) Option {
+	return func(r *Receiver) {
+		r.replays = s
+	}
+}
+
+// Verify checks the signature of the body and claims the webhook id it
+// returns. With the standard scheme the timestamp must be within the
+// tolerance. ErrReplay is returned with the id when it was already handled and
+// ErrInFlight when it is being handled. The claimed id must be given to Done.
+// The GitHub scheme has no timestamp and does not sign its X-GitHub-Delivery
+// id, only a resent delivery is caught, not a replay with another id
+func (r *Receiver) Verify(header http.Header, body []byte) (string, error) {
+	if r.scheme == signature.GitHub {
+		if err := r.verifyHub(header, body); err != nil {
+			return "", err
+		}
+		return r.claim(header.Get(signature.HeaderDelivery))
+	}
+	id := header.Get(signature.HeaderID)
+	rawTimestamp := header.Get(signature.HeaderTimestamp)
+	signatures := header.Get(signature.HeaderSignature)
+	if id == "" || rawTimestamp == "" || signatures == "" {
+		return "", ErrMissingSignature
+	}
+	seconds, err := strconv.ParseInt(rawTimestamp, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrTimestamp, err)
+	}
+	timestamp, now := time.Unix(seconds, 0), time.Now()
+	if timestamp.Before(now.Add(-r.tolerance)) || timestamp.After(now.Add(r.tolerance)) {
+		return "", ErrTimestamp
+	}
+	if !r.match(signatures, func(key []byte) string {
+		return signature.StandardSignature(key, id, timestamp, body)
+	}) {
+		return "", ErrInvalidSignature
+	}
+	return r.claim(id)
+}
+
+// Done settles the claimed webhook id. A handled id makes its next deliveries
+// replays, a failed one is released to be accepted when sent again
+func (r *Receiver) Done(id string, handled bool) {
+	if id == "" {
+		return
+	}
+	if !handled {
+		r.replays.Release(id)
+		return
+	}
+	// kept past the tolerance, an older webhook is rejected on its timestamp
+	r.replays.Record(id, r.expiry())
+}
+
+// claim claims the id, a GitHub delivery without id is not claimed
+func (r *Receiver) claim(id string) (string, error) {
+	if id == "" {
+		return "", nil
+	}
+	return id, r.replays.Claim(id, r.expiry())
+}
+
+// expiry returns the time the ids are kept until
+func (r *Receiver) expiry() time.Time {
+	return time.Now().Add(2 * r.tolerance)
+}
+
+func (r *Receiver) verifyHub(header http.Header, body []byte) error {
+	value := header.Get(signature.HeaderHub)
+	if value == "" {
+		return ErrMissingSignature
+	}
+	if !r.match(value, func(key []byte) string {
+		return signature.HubSignature(key, body)
+	}) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// match tells whether one of the space separated signatures is the one of a
+// key
+func (r *Receiver) match(signatures string, sign func([]byte) string) bool {
+	for _, key := range r.keys {
+		expected := []byte(sign(key))
+		for _, s := range strings.Fields(signatures) {
+			if hmac.Equal([]byte(s), expected) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Middleware verifies the requests before handing them to next. The body is
+// still readable by next, decompressed. It answers 400 when the signature
+// headers are missing, 401 when the signature or the timestamp is wrong, 413
+// when the body is too large and 415 on unknown content encoding. A webhook
+// already handled gets 200 without calling next and one being handled gets
+// 409 to be retried, it is handled once next answers 2xx
+func (r *Receiver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		log := logx.WithName(req.Context(), "Receiver.Middleware")
+		body, err := r.read(req)
+		var id string
+		if err == nil {
+			id, err = r.Verify(req.Header, body)
+		}
+		if errors.Is(err, ErrReplay) {
+			// the sender missed the answer of the first delivery
+			log.V(1).Info("webhook already handled", "id", id)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if err == nil {
+			// the signature covers the body as sent
+			body, err = r.decode(req.Header.Get("Content-Encoding"), body)
+			if err != nil {
+				r.Done(id, false)
+			}
+		}
+		if err != nil {
+			log.Error(err, "reject webhook")
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+		req.Header.Del("Content-Encoding")
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		sw := &statusWriter{ResponseWriter: w}
+		handled := false
+		// a panicking next releases the id too
+		defer func() { r.Done(id, handled) }()
+		next.ServeHTTP(sw, req)
+		handled = sw.status >= 200 && sw.status < 300
+	})
+}
+
+// Handler returns a handler verifying the requests then decoding the JSON body
+// into T for f. It answers 400 when the body is not a T, 500 when f fails and
+// 204 otherwise
+func Handler[T any](r *Receiver, f func(context.Context, T) error) http.Handler {
+	return r.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		log := logx.WithName(req.Context(), "Receiver.Handler")
+		var payload T
+		if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+			log.Error(err, "decode payload failed")
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+		if err := f(req.Context(), payload); err != nil {
+			log.Error(err, "handle payload failed")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+// read returns the body, failing when it is above the maximum size
+func (r *Receiver) read(req *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(req.Body, r.maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > r.maxBodySize {
+		return nil, ErrBodyTooLarge
+	}
+	return body, nil
+}
+
+// decode decompresses the gzip or zstd body, up to the maximum size
+func (r *Receiver) decode(encoding string, body []byte) ([]byte, error) {
+	var reader io.Reader
+	switch encoding {
+	case "", "identity":
+		return body, nil
+	case "gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = gz
+	case "zstd":
+		zr, err := zstd.NewReader(bytes.NewReader(body), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		reader = zr
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, encoding)
+	}
+	decoded, err := io.ReadAll(io.LimitReader(reader, r.maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(decoded)) > r.maxBodySize {
+		return nil, ErrBodyTooLarge
+	}
+	return decoded, nil
+}
+
+func statusCode(err error) int {
+	switch {
+	case errors.Is(err, ErrUnsupportedEncoding):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, ErrBodyTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrInvalidSignature), errors.Is(err, ErrTimestamp):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrInFlight):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// Claim records the id as being handled unless it is already recorded and not
+// expired, dropping the expired ids
+func (s *memoryStore) Claim(id string, expiry time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.Sub(s.lastSweep) > sweepInterval {
+		for k, state := range s.ids {
+			if state.expiry.Before(now) {
+				delete(s.ids, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	if state, ok := s.ids[id]; ok && !state.expiry.Before(now) {
+		if state.handled {
+			return ErrReplay
+		}
+		return ErrInFlight
+	}
+	s.ids[id] = replayState{expiry: expiry}
+	return nil
+}
+
+// Record keeps the id as handled until expiry
+func (s *memoryStore) Record(id string, expiry time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids[id] = replayState{expiry: expiry, handled: true}
+}
+
+// Release forgets the id
+func (s *memoryStore) Release(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.ids, id)
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap gives the http.ResponseController access to the writer
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,231 @@
+//go:build !integration
+
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package receiver_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/w6d-io/hook/event"
+	"github.com/w6d-io/hook/http"
+	"github.com/w6d-io/hook/receiver"
+	"github.com/w6d-io/hook/signature"
+)
+
+type payload struct {
+	Kind string `json:"kind"`
+}
+
+var _ = Describe("Receiver", func() {
+	var (
+		server   *httptest.Server
+		received chan payload
+		fail     error
+	)
+	serve := func(r *receiver.Receiver) {
+		server = httptest.NewServer(receiver.Handler(r, func(_ context.Context, p payload) error {
+			if fail != nil {
+				return fail
+			}
+			received <- p
+			return nil
+		}))
+	}
+	BeforeEach(func() {
+		received = make(chan payload, 1)
+		fail = nil
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+	// post sends the body signed with the key and the headers
+	post := func(body string, header nethttp.Header) int {
+		request, err := nethttp.NewRequest(nethttp.MethodPost, server.URL, strings.NewReader(body))
+		Expect(err).To(Succeed())
+		request.Header = header
+		response, err := nethttp.DefaultClient.Do(request)
+		Expect(err).To(Succeed())
+		_ = response.Body.Close()
+		return response.StatusCode
+	}
+	signed := func(scheme string, key []byte, id string, timestamp time.Time, body string) nethttp.Header {
+		header := nethttp.Header{}
+		Expect(signature.Sign(header, scheme, key, id, timestamp, []byte(body))).To(Succeed())
+		return header
+	}
+
+	Context("Standard", func() {
+		BeforeEach(func() {
+			r, err := receiver.New(signature.Standard, []string{"whsec_c2VjcmV0", "old"})
+			Expect(err).To(Succeed())
+			serve(r)
+		})
+		It("receives the webhooks of the http provider", func() {
+			secret := filepath.Join(GinkgoT().TempDir(), "secret")
+			Expect(os.WriteFile(secret, []byte("whsec_c2VjcmV0"), 0o600)).To(Succeed())
+			URL, err := url.Parse(server.URL + "?signature=standard&secretFile=" + secret)
+			Expect(err).To(Succeed())
+			h := &http.HTTP{}
+			Expect(h.Init(context.Background(), URL)).To(Succeed())
+			ctx := event.WithID(context.Background(), "msg_1")
+			Expect(h.Send(ctx, payload{Kind: "push"}, URL)).To(Succeed())
+			Expect(<-received).To(Equal(payload{Kind: "push"}))
+
+			By("accepting the replay without handling it again")
+			Expect(h.Send(ctx, payload{Kind: "push"}, URL)).To(Succeed())
+			Expect(received).ToNot(Receive())
+		})
+		It("handles the retry of a failed webhook", func() {
+			header := signed(signature.Standard, []byte("secret"), "msg_9", time.Now(), `{"kind":"push"}`)
+			fail = errors.New("handler failed")
+			Expect(post(`{"kind":"push"}`, header)).To(Equal(nethttp.StatusInternalServerError))
+			fail = nil
+			Expect(post(`{"kind":"push"}`, header)).To(Equal(nethttp.StatusNoContent))
+			Expect(<-received).To(Equal(payload{Kind: "push"}))
+			Expect(post(`{"kind":"push"}`, header)).To(Equal(nethttp.StatusOK))
+			Expect(received).ToNot(Receive())
+		})
+		DescribeTable("receives the compressed webhooks",
+			func(algorithm string) {
+				secret := filepath.Join(GinkgoT().TempDir(), "secret")
+				Expect(os.WriteFile(secret, []byte("whsec_c2VjcmV0"), 0o600)).To(Succeed())
+				URL, err := url.Parse(server.URL + "?signature=standard&compressThreshold=0&compress=" + algorithm + "&secretFile=" + secret)
+				Expect(err).To(Succeed())
+				h := &http.HTTP{}
+				Expect(h.Init(context.Background(), URL)).To(Succeed())
+				Expect(h.Send(context.Background(), payload{Kind: algorithm}, URL)).To(Succeed())
+				Expect(<-received).To(Equal(payload{Kind: algorithm}))
+			},
+			Entry("gzip", "gzip"),
+			Entry("zstd", "zstd"),
+		)
+		It("rejects an unknown encoding", func() {
+			header := signed(signature.Standard, []byte("secret"), "msg_8", time.Now(), `{"kind":"push"}`)
+			header.Set("Content-Encoding", "br")
+			Expect(post(`{"kind":"push"}`, header)).To(Equal(nethttp.StatusUnsupportedMediaType))
+		})
+		It("accepts the previous secret", func() {
+			Expect(post(`{"kind":"push"}`, signed(signature.Standard, []byte("old"), "msg_2", time.Now(), `{"kind":"push"}`))).
+				To(Equal(nethttp.StatusNoContent))
+		})
+		DescribeTable("rejects the bad webhooks",
+			func(body string, header func() nethttp.Header, code int) {
+				Expect(post(body, header())).To(Equal(code))
+				Expect(received).ToNot(Receive())
+			},
+			Entry("without signature", `{"kind":"push"}`, func() nethttp.Header { return nethttp.Header{} },
+				nethttp.StatusBadRequest),
+			Entry("with a wrong key", `{"kind":"push"}`, func() nethttp.Header {
+				return signed(signature.Standard, []byte("wrong"), "msg_3", time.Now(), `{"kind":"push"}`)
+			}, nethttp.StatusUnauthorized),
+			Entry("with a tampered body", `{"kind":"tag"}`, func() nethttp.Header {
+				return signed(signature.Standard, []byte("secret"), "msg_4", time.Now(), `{"kind":"push"}`)
+			}, nethttp.StatusUnauthorized),
+			Entry("with an old timestamp", `{"kind":"push"}`, func() nethttp.Header {
+				return signed(signature.Standard, []byte("secret"), "msg_5", time.Now().Add(-time.Hour), `{"kind":"push"}`)
+			}, nethttp.StatusUnauthorized),
+			Entry("with a bad payload", `["push"]`, func() nethttp.Header {
+				return signed(signature.Standard, []byte("secret"), "msg_6", time.Now(), `["push"]`)
+			}, nethttp.StatusBadRequest),
+		)
+		It("fails when the handler fails", func() {
+			fail = errors.New("handler failed")
+			Expect(post(`{"kind":"push"}`, signed(signature.Standard, []byte("secret"), "msg_7", time.Now(), `{"kind":"push"}`))).
+				To(Equal(nethttp.StatusInternalServerError))
+		})
+	})
+
+	Context("GitHub", func() {
+		BeforeEach(func() {
+			r, err := receiver.New(signature.GitHub, []string{"secret"}, receiver.WithMaxBodySize(32))
+			Expect(err).To(Succeed())
+			serve(r)
+		})
+		It("verifies the hub signature", func() {
+			Expect(post(`{"kind":"push"}`, signed(signature.GitHub, []byte("secret"), "", time.Now(), `{"kind":"push"}`))).
+				To(Equal(nethttp.StatusNoContent))
+			Expect(<-received).To(Equal(payload{Kind: "push"}))
+			Expect(post(`{"kind":"push"}`, signed(signature.GitHub, []byte("wrong"), "", time.Now(), `{"kind":"push"}`))).
+				To(Equal(nethttp.StatusUnauthorized))
+		})
+		It("accepts a resent delivery without handling it again", func() {
+			header := signed(signature.GitHub, []byte("secret"), "delivery_1", time.Now(), `{"kind":"push"}`)
+			Expect(header.Get(signature.HeaderDelivery)).To(Equal("delivery_1"))
+			Expect(post(`{"kind":"push"}`, header)).To(Equal(nethttp.StatusNoContent))
+			Expect(<-received).To(Equal(payload{Kind: "push"}))
+			Expect(post(`{"kind":"push"}`, header)).To(Equal(nethttp.StatusOK))
+			Expect(received).ToNot(Receive())
+		})
+		It("rejects a body too large", func() {
+			body := `{"kind":"` + string(bytes.Repeat([]byte("a"), 64)) + `"}`
+			Expect(post(body, signed(signature.GitHub, []byte("secret"), "", time.Now(), body))).
+				To(Equal(nethttp.StatusRequestEntityTooLarge))
+		})
+	})
+
+	Context("Concurrent", func() {
+		It("handles the same webhook once while it is being handled", func() {
+			r, err := receiver.New(signature.Standard, []string{"secret"})
+			Expect(err).To(Succeed())
+			entered, release := make(chan struct{}), make(chan struct{})
+			server = httptest.NewServer(r.Middleware(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, _ *nethttp.Request) {
+				entered <- struct{}{}
+				<-release
+				w.WriteHeader(nethttp.StatusNoContent)
+			})))
+			header := signed(signature.Standard, []byte("secret"), "msg_10", time.Now(), `{"kind":"push"}`)
+			first := make(chan int, 1)
+			go func() {
+				defer GinkgoRecover()
+				first <- post(`{"kind":"push"}`, header)
+			}()
+			<-entered
+
+			By("asking to retry the duplicate received meanwhile")
+			Expect(post(`{"kind":"push"}`, header)).To(Equal(nethttp.StatusConflict))
+			close(release)
+			Expect(<-first).To(Equal(nethttp.StatusNoContent))
+			Expect(post(`{"kind":"push"}`, header)).To(Equal(nethttp.StatusOK))
+		})
+	})
+
+	Context("New", func() {
+		It("fails on bad configuration", func() {
+			_, err := receiver.New("md5", []string{"secret"})
+			Expect(err).To(HaveOccurred())
+			_, err = receiver.New(signature.Standard, nil)
+			Expect(err).To(HaveOccurred())
+			_, err = receiver.New(signature.Standard, []string{"whsec_!!!"})
+			Expect(err).To(HaveOccurred())
+			server = httptest.NewServer(nil)
+		})
+	})
+})
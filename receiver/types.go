@@ -0,0 +1,89 @@
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package receiver
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Receiver verifies the webhooks signed by the Hook http provider
+type Receiver struct {
+	scheme      string
+	keys        [][]byte
+	tolerance   time.Duration
+	maxBodySize int64
+	replays     ReplayStore
+}
+
+// Option configures a Receiver
+type Option func(*Receiver)
+
+// ReplayStore remembers the webhook ids being handled and already handled
+type ReplayStore interface {
+	// Claim records the id as being handled until expiry, in one operation.
+	// It fails with ErrReplay when the id is handled and ErrInFlight when it
+	// is being handled
+	Claim(id string, expiry time.Time) error
+	// Record keeps the claimed id as handled until expiry
+	Record(id string, expiry time.Time)
+	// Release forgets the claimed id, so it is accepted when sent again
+	Release(id string)
+}
+
+// statusWriter keeps the status code written by the handler
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// memoryStore is the in-memory ReplayStore used by default
+type memoryStore struct {
+	mu        sync.Mutex
+	ids       map[string]replayState
+	lastSweep time.Time
+}
+
+// replayState is the state of an id in the memoryStore
+type replayState struct {
+	expiry  time.Time
+	handled bool
+}
+
+// sweepInterval is the minimum delay between two removals of the expired ids
+const sweepInterval = time.Minute
+
+const (
+	// DefaultTolerance is the maximum gap between the webhook timestamp and
+	// the time of reception
+	DefaultTolerance = 5 * time.Minute
+	// DefaultMaxBodySize is the maximum size of the body read
+	DefaultMaxBodySize = 1 << 20
+)
+
+var (
+	ErrMissingSignature    = errors.New("missing signature")
+	ErrInvalidSignature    = errors.New("invalid signature")
+	ErrTimestamp           = errors.New("timestamp out of tolerance")
+	ErrReplay              = errors.New("webhook already handled")
+	ErrInFlight            = errors.New("webhook being handled")
+	ErrBodyTooLarge        = errors.New("body too large")
+	ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+)
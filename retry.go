@@ -0,0 +1,221 @@
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package hook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/avast/retry-go"
+)
+
+// Backoff is the way the delay grows between two attempts
+type Backoff string
+
+const (
+	// BackoffExponential doubles the delay on each attempt
+	BackoffExponential Backoff = "exponential"
+	// BackoffFixed keeps the initial delay between all attempts
+	BackoffFixed Backoff = "fixed"
+)
+
+// RetryPolicy tells how a failed delivery is retried
+type RetryPolicy struct {
+	// Retries is the number of attempts after the first one
+	Retries      uint
+	Backoff      Backoff
+	InitialDelay time.Duration
+	// MaxDelay caps the delay between two attempts, no cap when zero. A longer
+	// delay asked by the target fails the delivery, beyond one minute when zero
+	MaxDelay time.Duration
+	// Jitter is the maximum random duration added to each delay
+	Jitter time.Duration
+}
+
+// DefaultRetryPolicy is used by the subscriptions without retry parameters
+var DefaultRetryPolicy = RetryPolicy{
+	Retries:      4,
+	Backoff:      BackoffExponential,
+	InitialDelay: 100 * time.Millisecond,
+	Jitter:       100 * time.Millisecond,
+}
+
+// maxRetryAfter caps the delay asked by the target when the policy has no
+// MaxDelay
+const maxRetryAfter = time.Minute
+
+// retryParams are the subscription URL query parameters of the retry policy
+var retryParams = []string{"retries", "backoff", "initialDelay", "maxDelay", "jitter"}
+
+// WithRetryPolicy sets the retry policy of the subscriptions without retry
+// parameters
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(h *Hook) {
+		h.retryPolicy = p
+	}
+}
+
+// ParseRetryPolicy overrides the policy fields set in the query values.
+// Durations use the time.ParseDuration format
+//
+// Example:
+//
+//	?retries=3&backoff=fixed&initialDelay=1s&maxDelay=10s&jitter=200ms
+func ParseRetryPolicy(p RetryPolicy, values url.Values) (RetryPolicy, error) {
+	if v := values.Get("retries"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return p, fmt.Errorf("retries: %w", err)
+		}
+		p.Retries = uint(n)
+	}
+	if v := values.Get("backoff"); v != "" {
+		switch Backoff(v) {
+		case BackoffExponential, BackoffFixed:
+			p.Backoff = Backoff(v)
+		default:
+			return p, fmt.Errorf("backoff %q not supported", v)
+		}
+	}
+	durations := map[string]*time.Duration{
+		"initialDelay": &p.InitialDelay,
+		"maxDelay":     &p.MaxDelay,
+		"jitter":       &p.Jitter,
+	}
+	for key, d := range durations {
+		v := values.Get(key)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return p, fmt.Errorf("%s: %w", key, err)
+		}
+		if parsed < 0 {
+			return p, fmt.Errorf("%s: negative duration %s", key, v)
+		}
+		*d = parsed
+	}
+	return p, nil
+}
+
+// options returns the retry-go options applying the policy, the retries stop
+// when ctx is done
+func (p RetryPolicy) options(ctx context.Context) []retry.Option {
+	delay := retry.BackOffDelay
+	if p.Backoff == BackoffFixed {
+		delay = retry.FixedDelay
+	}
+	opts := []retry.Option{
+		retry.Attempts(p.Retries + 1),
+		retry.Delay(p.InitialDelay),
+		retry.LastErrorOnly(true),
+		retry.Context(ctx),
+		retry.RetryIf(isRetryable),
+	}
+	if p.Jitter > 0 {
+		delay = retry.CombineDelay(delay, retry.RandomDelay)
+		opts = append(opts, retry.MaxJitter(p.Jitter))
+	}
+	return append(opts, retry.DelayType(p.delayType(delay)))
+}
+
+// delayType caps the delay of the policy with MaxDelay, then waits at least
+// the delay asked by the target, up to maxWait
+func (p RetryPolicy) delayType(delay retry.DelayTypeFunc) retry.DelayTypeFunc {
+	return func(n uint, err error, config *retry.Config) time.Duration {
+		d := delay(n, err, config)
+		if p.MaxDelay > 0 && d > p.MaxDelay {
+			d = p.MaxDelay
+		}
+		if wait := retryAfter(err); wait > d {
+			d = wait
+		}
+		if limit := p.maxWait(); d > limit {
+			d = limit
+		}
+		return d
+	}
+}
+
+// maxWait is the longest delay asked by the target the policy waits for,
+// MaxDelay or maxRetryAfter when not set
+func (p RetryPolicy) maxWait() time.Duration {
+	if p.MaxDelay > 0 {
+		return p.MaxDelay
+	}
+	return maxRetryAfter
+}
+
+// retryAfter returns the delay asked by the target, zero when none
+func retryAfter(err error) time.Duration {
+	var r RetryAfterError
+	if errors.As(err, &r) {
+		return r.RetryAfter()
+	}
+	return 0
+}
+
+// within gives up on the error when the delay asked by the target is longer
+// than the policy waits for, or ends after the deadline of ctx
+func (p RetryPolicy) within(ctx context.Context, err error) error {
+	wait := retryAfter(err)
+	if wait <= 0 {
+		return err
+	}
+	if limit := p.maxWait(); wait > limit {
+		return &waitExceededError{err: err, wait: wait, limit: fmt.Sprintf("the maximum delay %s", limit)}
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+		return &waitExceededError{err: err, wait: wait, limit: "the deadline"}
+	}
+	return err
+}
+
+// waitExceededError stops the retries when the target asks to wait longer
+// than the policy allows or past the deadline
+type waitExceededError struct {
+	err   error
+	wait  time.Duration
+	limit string
+}
+
+func (e *waitExceededError) Error() string {
+	return fmt.Sprintf("%v: retry after %s exceeds %s", e.err, e.wait, e.limit)
+}
+
+func (e *waitExceededError) Unwrap() error {
+	return e.err
+}
+
+func (e *waitExceededError) Retryable() bool {
+	return false
+}
+
+// isRetryable tells whether the error of a provider is worth another attempt
+func isRetryable(err error) bool {
+	var r RetryableError
+	if errors.As(err, &r) {
+		return r.Retryable()
+	}
+	return retry.IsRecoverable(err)
+}
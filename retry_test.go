@@ -0,0 +1,139 @@
+//go:build !integration
+
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package hook_test
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/w6d-io/hook"
+)
+
+var _ = Describe("Retry policy", func() {
+	Context("parse", func() {
+		It("keeps the defaults without parameters", func() {
+			p, err := hook.ParseRetryPolicy(hook.DefaultRetryPolicy, url.Values{})
+			Expect(err).To(Succeed())
+			Expect(p).To(Equal(hook.DefaultRetryPolicy))
+		})
+		It("overrides the fields set", func() {
+			values, _ := url.ParseQuery("retries=2&backoff=fixed&initialDelay=1s&maxDelay=10s&jitter=0s")
+			p, err := hook.ParseRetryPolicy(hook.DefaultRetryPolicy, values)
+			Expect(err).To(Succeed())
+			Expect(p).To(Equal(hook.RetryPolicy{
+				Retries:      2,
+				Backoff:      hook.BackoffFixed,
+				InitialDelay: time.Second,
+				MaxDelay:     10 * time.Second,
+			}))
+		})
+		DescribeTable("rejects bad values",
+			func(query, message string) {
+				values, _ := url.ParseQuery(query)
+				_, err := hook.ParseRetryPolicy(hook.DefaultRetryPolicy, values)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring(message))
+			},
+			Entry("retries", "retries=-1", "retries"),
+			Entry("backoff", "backoff=linear", "not supported"),
+			Entry("initialDelay", "initialDelay=1", "initialDelay"),
+			Entry("maxDelay", "maxDelay=-1s", "negative"),
+			Entry("jitter", "jitter=abc", "jitter"),
+		)
+	})
+	Context("subscription", func() {
+		It("applies the retries of the URL", func() {
+			h := hook.New(hook.WithProvider("http", NewTestSendFail))
+			Expect(h.Subscribe(context.Background(), "http://localhost?retries=2&backoff=fixed&initialDelay=1ms&jitter=0s", "*")).ToNot(BeEmpty())
+			report, err := h.Deliver(context.Background(), "message", "test")
+			Expect(err).To(HaveOccurred())
+			Expect(report.Deliveries[0].Attempts).To(Equal(uint(3)))
+		})
+		It("applies the policy of the Hook", func() {
+			h := hook.New(
+				hook.WithProvider("http", NewTestSendFail),
+				hook.WithRetryPolicy(hook.RetryPolicy{Backoff: hook.BackoffFixed}),
+			)
+			Expect(h.Subscribe(context.Background(), "http://localhost", "*")).ToNot(BeEmpty())
+			report, err := h.Deliver(context.Background(), "message", "test")
+			Expect(err).To(HaveOccurred())
+			Expect(report.Deliveries[0].Attempts).To(Equal(uint(1)))
+		})
+		It("does not give the retry parameters to the provider", func() {
+			var initURL *url.URL
+			h := hook.New(hook.WithProvider("http", func() hook.Interface {
+				return &TestInitURL{URL: &initURL}
+			}))
+			Expect(h.Subscribe(context.Background(), "http://localhost?retries=1&id={{.id}}&jitter=1s", "*")).ToNot(BeEmpty())
+			Expect(initURL.String()).To(Equal("http://localhost?id={{.id}}"))
+		})
+		It("does not retry a not retryable error", func() {
+			h := hook.New(hook.WithProvider("http", func() hook.Interface { return &TestNotRetryable{} }))
+			Expect(h.Subscribe(context.Background(), "http://localhost", "*")).ToNot(BeEmpty())
+			report, err := h.Deliver(context.Background(), "message", "test")
+			Expect(err).To(MatchError(ContainSubstring("not retryable")))
+			Expect(report.Deliveries[0].Attempts).To(Equal(uint(1)))
+		})
+		It("waits the delay asked by the target", func() {
+			h := hook.New(hook.WithProvider("http", func() hook.Interface {
+				return &TestRetryAfter{Wait: 200 * time.Millisecond}
+			}))
+			Expect(h.Subscribe(context.Background(), "http://localhost?retries=1&initialDelay=1ms&maxDelay=1s&jitter=0s", "*")).ToNot(BeEmpty())
+			start := time.Now()
+			report, err := h.Deliver(context.Background(), "message", "test")
+			Expect(err).To(MatchError(ContainSubstring("rate limited")))
+			Expect(report.Deliveries[0].Attempts).To(Equal(uint(2)))
+			Expect(time.Since(start)).To(BeNumerically(">=", 200*time.Millisecond))
+		})
+		DescribeTable("gives up when the delay asked is longer than the maximum delay",
+			func(query, limit string) {
+				h := hook.New(hook.WithProvider("http", func() hook.Interface {
+					return &TestRetryAfter{Wait: time.Hour}
+				}))
+				Expect(h.Subscribe(context.Background(), "http://localhost"+query, "*")).ToNot(BeEmpty())
+				report, err := h.Deliver(context.Background(), "message", "test")
+				Expect(err).To(MatchError(ContainSubstring("exceeds the maximum delay " + limit)))
+				Expect(report.Deliveries[0].Attempts).To(Equal(uint(1)))
+			},
+			Entry("set by the policy", "?maxDelay=10s", "10s"),
+			Entry("by default", "", "1m0s"),
+		)
+		It("gives up when the delay asked ends after the deadline", func() {
+			h := hook.New(hook.WithProvider("http", func() hook.Interface {
+				return &TestRetryAfter{Wait: 30 * time.Second}
+			}))
+			Expect(h.Subscribe(context.Background(), "http://localhost", "*")).ToNot(BeEmpty())
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			report, err := h.Deliver(ctx, "message", "test")
+			Expect(err).To(MatchError(ContainSubstring("exceeds the deadline")))
+			Expect(report.Deliveries[0].Attempts).To(Equal(uint(1)))
+			Expect(ctx.Err()).To(Succeed())
+		})
+		It("fails on bad parameter", func() {
+			_, err := hook.New().Subscribe(context.Background(), "http://localhost?retries=many", "*")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,106 @@
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+// Package signature signs the webhook bodies with HMAC-SHA256, following the
+// Standard Webhooks spec or the GitHub X-Hub-Signature-256 header
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Standard signs with the webhook-id, webhook-timestamp and
+	// webhook-signature headers of the Standard Webhooks spec
+	Standard = "standard"
+	// GitHub signs with the X-Hub-Signature-256 header
+	GitHub = "github"
+)
+
+const (
+	HeaderID        = "webhook-id"
+	HeaderTimestamp = "webhook-timestamp"
+	HeaderSignature = "webhook-signature"
+	HeaderHub       = "X-Hub-Signature-256"
+	// HeaderDelivery carries the id with the GitHub scheme, outside of the
+	// signature
+	HeaderDelivery = "X-GitHub-Delivery"
+)
+
+// secretPrefix marks the base64 encoded secrets of the Standard Webhooks spec
+const secretPrefix = "whsec_"
+
+// Supported tells whether the scheme is known
+func Supported(scheme string) bool {
+	return scheme == Standard || scheme == GitHub
+}
+
+// Secret returns the key of the raw secret. A secret prefixed by whsec_ is
+// base64 decoded, the others are used as is
+func Secret(raw string) ([]byte, error) {
+	if !strings.HasPrefix(raw, secretPrefix) {
+		return []byte(raw), nil
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(raw, secretPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("decode secret: %w", err)
+	}
+	return key, nil
+}
+
+// Sign sets the signature headers of the scheme for the body
+func Sign(header http.Header, scheme string, key []byte, id string, timestamp time.Time, body []byte) error {
+	switch scheme {
+	case Standard:
+		header.Set(HeaderID, id)
+		header.Set(HeaderTimestamp, strconv.FormatInt(timestamp.Unix(), 10))
+		header.Set(HeaderSignature, StandardSignature(key, id, timestamp, body))
+	case GitHub:
+		header.Set(HeaderHub, HubSignature(key, body))
+		if id != "" {
+			header.Set(HeaderDelivery, id)
+		}
+	default:
+		return fmt.Errorf("signature %q not supported", scheme)
+	}
+	return nil
+}
+
+// StandardSignature returns the webhook-signature value, the HMAC-SHA256 of
+// "id.timestamp.body" in base64 prefixed by the version
+func StandardSignature(key []byte, id string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	_, _ = fmt.Fprintf(mac, "%s.%d.", id, timestamp.Unix())
+	_, _ = mac.Write(body)
+	return "v1," + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// HubSignature returns the X-Hub-Signature-256 value, the HMAC-SHA256 of the
+// body in hexadecimal prefixed by the algorithm
+func HubSignature(key []byte, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,66 @@
+//go:build !integration
+
+/*
+Copyright 2020 WILDCARD
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+Created on 18/10/2026
+*/
+
+package signature_test
+
+import (
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/w6d-io/hook/signature"
+)
+
+var _ = Describe("Signature", func() {
+	Context("Secret", func() {
+		It("decodes the standard secret", func() {
+			Expect(signature.Secret("whsec_c2VjcmV0")).To(Equal([]byte("secret")))
+		})
+		It("keeps the other secrets", func() {
+			Expect(signature.Secret("secret")).To(Equal([]byte("secret")))
+		})
+		It("fails on bad encoding", func() {
+			_, err := signature.Secret("whsec_!!!")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Context("Sign", func() {
+		It("matches the Standard Webhooks example", func() {
+			key, err := signature.Secret("whsec_MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw")
+			Expect(err).To(Succeed())
+			header := http.Header{}
+			body := []byte(`{"test": 2432232314}`)
+			Expect(signature.Sign(header, signature.Standard, key, "msg_p5jXN8AQM9LWM0D4loKWxJek", time.Unix(1614265330, 0), body)).To(Succeed())
+			Expect(header.Get(signature.HeaderID)).To(Equal("msg_p5jXN8AQM9LWM0D4loKWxJek"))
+			Expect(header.Get(signature.HeaderTimestamp)).To(Equal("1614265330"))
+			Expect(header.Get(signature.HeaderSignature)).To(Equal("v1,g0hM9SsE+OTPJTGt/tmIKtSyZlE3uFJELVlNIOLJ1OE="))
+		})
+		It("matches the GitHub example", func() {
+			header := http.Header{}
+			Expect(signature.Sign(header, signature.GitHub, []byte("It's a Secret to Everybody"), "", time.Now(), []byte("Hello, World!"))).To(Succeed())
+			Expect(header.Get(signature.HeaderHub)).To(Equal("sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"))
+		})
+		It("fails on unknown scheme", func() {
+			Expect(signature.Sign(http.Header{}, "md5", nil, "", time.Now(), nil)).ToNot(Succeed())
+			Expect(signature.Supported("md5")).To(BeFalse())
+		})
+	})
+})
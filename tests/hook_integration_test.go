@@ -44,7 +44,7 @@ var _ = Describe("", func() {
 		})
 		It("produces successfully", func() {
 			By("init kafka subscription", func() {
-				Expect(hook.Subscribe(ctx, fmt.Sprintf("kafka://%s?topic=%s&protocol=SASL_SSL&mechanisms=PLAIN&messagekey=test", kafkaHost, topic), "*")).To(Succeed())
+				Expect(hook.Subscribe(ctx, fmt.Sprintf("kafka://%s?topic=%s&protocol=SASL_SSL&mechanisms=PLAIN&messagekey=test", kafkaHost, topic), "*")).ToNot(BeEmpty())
 			})
 
 			By("Send payload")
@@ -59,7 +59,8 @@ var _ = Describe("", func() {
 
 		})
 		It("misses the topic", func() {
-			Expect(hook.Subscribe(ctx, fmt.Sprintf("kafka://%s", kafkaHost), "*")).ToNot(Succeed())
+			_, err := hook.Subscribe(ctx, fmt.Sprintf("kafka://%s", kafkaHost), "*")
+			Expect(err).To(HaveOccurred())
 		})
 
 	})
@@ -18,10 +18,48 @@ package hook
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/url"
+	"regexp"
+	"sync"
+	"time"
 )
 
-type Hook struct{}
+// Hook dispatches payloads to its subscribers according to their scope
+type Hook struct {
+	mu          sync.RWMutex
+	suppliers   providers
+	subscribers []subscriber
+	closed      bool
+	wg          sync.WaitGroup
+	pending     int64
+
+	reportHandler  func(context.Context, *DeliveryReport)
+	outbox         *Outbox
+	replayInterval time.Duration
+	replayLimit    int
+	done           chan struct{}
+
+	retryPolicy RetryPolicy
+
+	deliveryTimeout time.Duration
+	// lifetime is the parent of the asynchronous deliveries, cancelled by Close
+	lifetime context.Context
+	cancel   context.CancelFunc
+
+	queue    chan job
+	workers  int
+	overflow OverflowPolicy
+	dropped  uint64
+
+	dlMu        sync.Mutex
+	deadLetters []DeadLetter
+	dlForgotten uint64
+}
+
+// Option configures a Hook built by New
+type Option func(*Hook)
 
 type Interface interface {
 	Validate(*url.URL) error
@@ -29,14 +67,139 @@ type Interface interface {
 	Send(context.Context, interface{}, *url.URL) error
 }
 
+// RetryableError is implemented by the provider errors knowing whether the
+// delivery may succeed on a later attempt. The other errors are retried
+type RetryableError interface {
+	error
+	Retryable() bool
+}
+
+// RetryAfterError is implemented by the provider errors carrying the delay
+// asked by the target before the next attempt, like an HTTP Retry-After
+type RetryAfterError interface {
+	error
+	RetryAfter() time.Duration
+}
+
+// Closer is implemented by the providers holding resources to release, like
+// flushing a producer, when the Hook is closed
+type Closer interface {
+	Close(context.Context) error
+}
+
+var defaultHook = New()
+
 var (
-	suppliers   = make(providers)
-	subscribers []subscriber
+	// ErrSubscriptionNotFound is returned by Unsubscribe for an unknown id
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	// ErrClosed is returned when sending through or subscribing to a closed Hook
+	ErrClosed = errors.New("hook is closed")
+	// ErrDropped is returned by Close when pending deliveries were abandoned
+	ErrDropped = errors.New("deliveries dropped")
+	// ErrDeadLetterNotFound is returned by Redrive for an unknown id
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+	// ErrQueueFull is returned by Send when the queue is full with OverflowError
+	ErrQueueFull = errors.New("send queue is full")
 )
 
-type providers map[string]Interface
+// hookParams are the subscription URL query parameters handled by the Hook,
+// they are removed before the URL is given to the provider
+var hookParams = append([]string{"deadLetter"}, retryParams...)
+
+// Factory returns a new, not yet initialized, provider instance
+type Factory func() Interface
+
+type providers map[string]Factory
 
 type subscriber struct {
-	URL   *url.URL
-	Scope string
+	ID     string
+	URL    *url.URL
+	Scope  string
+	Sender Interface
+	Retry  RetryPolicy
+	// DeadLetter receives the deliveries exhausting their retries
+	DeadLetter *target
+	// scope is Scope compiled, nil when invalid
+	scope *regexp.Regexp
+	// key identifies the subscription in the outbox across restarts
+	key string
+	// usage closes the senders once the subscriber is removed and unused
+	usage *usage
+}
+
+// usage counts the deliveries in flight with a subscriber
+type usage struct {
+	mu      sync.Mutex
+	n       int
+	removed bool
+	closed  bool
+}
+
+type target struct {
+	URL    *url.URL
+	Sender Interface
+}
+
+// DeliveryStatus is the outcome of a delivery to one subscription
+type DeliveryStatus string
+
+const (
+	// StatusDelivered means the provider accepted the payload
+	StatusDelivered DeliveryStatus = "delivered"
+	// StatusFailed means the payload was not delivered, see Delivery.Err
+	StatusFailed DeliveryStatus = "failed"
+	// StatusSkipped means the subscription scope does not match
+	StatusSkipped DeliveryStatus = "skipped"
+)
+
+// Delivery reports the sending of a payload to one subscription
+type Delivery struct {
+	// SubscriptionID is the id returned by Subscribe
+	SubscriptionID string
+	// URL is the subscription URL with the password redacted
+	URL      string
+	Status   DeliveryStatus
+	Err      error
+	Attempts uint
+	Latency  time.Duration
+	// DeadLetterID is set when the failed delivery went to the dead-letter target
+	DeadLetterID string
+}
+
+// DeliveryReport gathers the deliveries of a payload to all the subscriptions
+type DeliveryReport struct {
+	Scope      string
+	Deliveries []Delivery
+}
+
+// Err joins the errors of the failed deliveries
+func (r *DeliveryReport) Err() error {
+	var errs []error
+	for _, d := range r.Deliveries {
+		if d.Status == StatusFailed {
+			errs = append(errs, fmt.Errorf("%s: %w", d.URL, d.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// handled tells whether every failed delivery went to a dead-letter target
+func (r *DeliveryReport) handled() bool {
+	for _, d := range r.Deliveries {
+		if d.Status == StatusFailed && d.DeadLetterID == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Failed returns the failed deliveries
+func (r *DeliveryReport) Failed() []Delivery {
+	var failed []Delivery
+	for _, d := range r.Deliveries {
+		if d.Status == StatusFailed {
+			failed = append(failed, d)
+		}
+	}
+	return failed
 }